@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	peerstore "github.com/libp2p/go-libp2p-peerstore"
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/net"
+	"github.com/multiformats/go-multiaddr"
+
+	"github.com/mikelsr/nahs-demo/demo/v2"
+)
+
+// roles of the agents that can be started
+const (
+	roleBike       = "bike"
+	roleLocator    = "locator"
+	rolePerson     = "person"
+	roleRebalancer = "rebalancer"
+	roleRenter     = "renter"
+	roleStation    = "station"
+	roleTransport  = "transport"
+	roleUniversity = "university"
+)
+
+// config of a single agent
+type config struct {
+	// Role of the agent: bike, locator, person, rebalancer, renter,
+	// station, transport or university
+	Role string `json:"role"`
+	// Coords of a station or the initial position of a transport
+	Coords v2.Coords `json:"coords"`
+	// Docks is the number of dock slots of a station, unlimited if 0
+	Docks int `json:"docks"`
+	// Locator a station registers with once started, or a person
+	// searches the stations of every renter with
+	Locator string `json:"locator"`
+	// Operator is the ID of the renter controlling a station
+	Operator string `json:"operator"`
+	// Listen multiaddrs of the node, a random TCP port is used if empty
+	Listen []string `json:"listen"`
+	// Key is the file with the private key of the node, it is created if
+	// it doesn't exist so that the node keeps its ID between runs
+	Key string `json:"key"`
+	// Peers are the multiaddrs, including the /p2p/ part, of the nodes
+	// this node has to reach
+	Peers []string `json:"peers"`
+	// Contacts are the services offered by the known peers
+	Contacts []contact `json:"contacts"`
+	// Stations controlled by a renter, served by a transport or watched
+	// by a rebalancer, or the nearest station of a university
+	Stations []string `json:"stations"`
+	// Pricing strategy of a renter
+	Pricing *v2.PricingSpec `json:"pricing"`
+	// Buyer is the negotiation strategy of a person
+	Buyer *v2.BuyerStrategy `json:"buyer"`
+	// Shopping is how a person chooses among the bikes offered
+	Shopping *v2.ShoppingSpec `json:"shopping"`
+	// StationPreference is how a person chooses among the stations found
+	StationPreference *v2.StationPreference `json:"stationPreference"`
+	// Seller is the negotiation strategy of a renter
+	Seller *v2.SellerStrategy `json:"seller"`
+	// ReservationTTL is how long a renter holds the bikes it offers, e.g. "1m"
+	ReservationTTL string `json:"reservationTTL"`
+	// Capacity in bikes and Speed in meters per second of the
+	// vehicle of a transport
+	Capacity int     `json:"capacity"`
+	Speed    float64 `json:"speed"`
+	// Distance is how the agent measures distances, in a straight line
+	// if not set. The street network file is relative to the config.
+	Distance *v2.DistanceSpec `json:"distance"`
+	// Rebalance is the policy of a rebalancer
+	Rebalance *v2.RebalanceSpec `json:"rebalance"`
+	// Dock is the station a bike docks at once started
+	Dock string `json:"dock"`
+	// Travel of a person once started
+	Travel *travel `json:"travel"`
+	// Request of bikes of a university once started
+	Request *request `json:"request"`
+}
+
+// contact offering a service
+type contact struct {
+	Peer     string   `json:"peer"`
+	Protocol string   `json:"protocol"`
+	Roles    []string `json:"roles"`
+}
+
+type travel struct {
+	From v2.Coords `json:"from"`
+	To   v2.Coords `json:"to"`
+}
+
+type request struct {
+	Bikes int `json:"bikes"`
+	// In is the time until the bikes are needed, e.g. "10s"
+	In string `json:"in"`
+}
+
+func loadConfig(path string) (config, error) {
+	c := config{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("Invalid config '%s': %s", path, err)
+	}
+	if c.Distance != nil && c.Distance.Network != "" && !filepath.IsAbs(c.Distance.Network) {
+		c.Distance.Network = filepath.Join(filepath.Dir(path), c.Distance.Network)
+	}
+	return c, c.validate()
+}
+
+func (c config) validate() error {
+	switch c.Role {
+	case roleBike, roleLocator, rolePerson, roleRebalancer, roleRenter, roleStation, roleTransport:
+	case roleUniversity:
+		if len(c.Stations) != 1 {
+			return errors.New("A university needs exactly one station")
+		}
+	default:
+		return fmt.Errorf("Unknown role '%s'", c.Role)
+	}
+	if c.Pricing != nil {
+		if _, err := c.Pricing.NewStrategy(); err != nil {
+			return err
+		}
+	}
+	if c.Buyer != nil {
+		if err := c.Buyer.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Shopping != nil {
+		if _, err := c.Shopping.NewStrategy(); err != nil {
+			return err
+		}
+	}
+	if c.StationPreference != nil {
+		if err := c.StationPreference.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Seller != nil {
+		if err := c.Seller.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.ReservationTTL != "" {
+		if ttl, err := time.ParseDuration(c.ReservationTTL); err != nil || ttl <= 0 {
+			return fmt.Errorf("Invalid reservation TTL: '%s'", c.ReservationTTL)
+		}
+	}
+	if err := c.Coords.Validate(); err != nil {
+		return err
+	}
+	if c.Travel != nil {
+		for _, coords := range []v2.Coords{c.Travel.From, c.Travel.To} {
+			if err := coords.Validate(); err != nil {
+				return fmt.Errorf("Invalid travel: %s", err)
+			}
+		}
+	}
+	if c.Docks < 0 {
+		return fmt.Errorf("Invalid dock number: %d", c.Docks)
+	}
+	if c.Locator != "" {
+		if _, err := peer.IDB58Decode(c.Locator); err != nil {
+			return fmt.Errorf("Invalid locator ID: '%s'", c.Locator)
+		}
+	}
+	if c.Capacity < 0 || c.Speed < 0 {
+		return errors.New("Invalid vehicle capacity or speed")
+	}
+	if c.Distance != nil {
+		if err := c.Distance.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Rebalance != nil {
+		if _, err := c.Rebalance.NewPolicy(); err != nil {
+			return err
+		}
+	}
+	if c.Request != nil {
+		if _, err := time.ParseDuration(c.Request.In); err != nil {
+			return fmt.Errorf("Invalid request time: '%s'", c.Request.In)
+		}
+	}
+	for _, ct := range c.Contacts {
+		if _, found := v2.Protocol(ct.Protocol); !found {
+			return fmt.Errorf("Unknown protocol '%s'", ct.Protocol)
+		}
+	}
+	return nil
+}
+
+// nodeOptions returns the options to create the node of the agent with
+func (c config) nodeOptions() ([]libp2p.Option, error) {
+	options := make([]libp2p.Option, 0)
+	if len(c.Listen) > 0 {
+		options = append(options, libp2p.ListenAddrStrings(c.Listen...))
+	}
+	if c.Key != "" {
+		sk, err := loadKey(c.Key)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, libp2p.Identity(sk))
+	}
+	return options, nil
+}
+
+// connect stores the addresses of the peers and the services they offer
+func (c config) connect(n *nahs.Node) error {
+	for _, addr := range c.Peers {
+		ma, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return fmt.Errorf("Invalid peer address '%s': %s", addr, err)
+		}
+		info, err := peer.AddrInfoFromP2pAddr(ma)
+		if err != nil {
+			return fmt.Errorf("Invalid peer address '%s': %s", addr, err)
+		}
+		n.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+	}
+	for _, ct := range c.Contacts {
+		id, err := peer.IDB58Decode(ct.Peer)
+		if err != nil {
+			return fmt.Errorf("Invalid contact ID '%s'", ct.Peer)
+		}
+		p, found := v2.Protocol(ct.Protocol)
+		if !found {
+			return fmt.Errorf("Unknown protocol '%s'", ct.Protocol)
+		}
+		roles := make([]bspl.Role, len(ct.Roles))
+		for i, r := range ct.Roles {
+			roles[i] = bspl.Role(r)
+		}
+		n.AddContact(id, net.Service{Roles: roles, Protocol: p})
+	}
+	return nil
+}
+
+// loadKey reads a private key from a file, or generates
+// it and stores it in the file if it doesn't exist
+func loadKey(path string) (crypto.PrivKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return crypto.UnmarshalPrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	sk, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = crypto.MarshalPrivateKey(sk); err != nil {
+		return nil, err
+	}
+	return sk, ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,173 @@
+// Command agent starts a single agent of the demo from a config file,
+// so that the agents can run as separate processes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ipfs/go-log"
+	"github.com/mikelsr/nahs"
+
+	"github.com/mikelsr/nahs-demo/demo/v2"
+)
+
+var logger = log.Logger("nahs-demo/agent")
+
+func main() {
+	configPath := flag.String("config", "agent.json", "config file of the agent")
+	flag.Parse()
+
+	log.SetAllLoggers(log.LevelInfo)
+	log.SetLogLevel("nahs-demo/v2", "debug")
+
+	if err := v2.LoadProtocolsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if v2.NodeOptions, err = c.nodeOptions(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// agents on their own processes tell the time with the wall clock
+	o := v2.AgentOptions{Clock: v2.WallClock{}}
+	if c.Distance != nil {
+		if o.Distances, err = c.Distance.NewProvider(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	node, run, err := newAgent(c, o)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := c.connect(node); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger.Infof("Started %s with ID %s", c.Role, node.ID().Pretty())
+	for _, addr := range node.Addrs() {
+		logger.Infof("Listening on %s/p2p/%s", addr, node.ID().Pretty())
+	}
+
+	if run != nil {
+		go func() {
+			if err := run(); err != nil {
+				logger.Error(err)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+}
+
+// newAgent creates the agent given its config and options and returns
+// its node and what the agent does once started, if anything
+func newAgent(c config, o v2.AgentOptions) (*nahs.Node, func() error, error) {
+	switch c.Role {
+	case roleBike:
+		b := v2.NewBike(o)
+		if c.Dock == "" {
+			return b.Node, nil, nil
+		}
+		return b.Node, func() error { return b.Dock(c.Dock) }, nil
+	case roleLocator:
+		return v2.NewLocator(o).Node, nil, nil
+	case rolePerson:
+		p := v2.NewPerson(o)
+		if c.Buyer != nil {
+			p.SetNegotiation(*c.Buyer)
+		}
+		if c.Shopping != nil {
+			shopping, err := c.Shopping.NewStrategy()
+			if err != nil {
+				return nil, nil, err
+			}
+			p.SetShopping(shopping)
+		}
+		if c.StationPreference != nil {
+			p.SetStationPreference(*c.StationPreference)
+		}
+		if c.Locator != "" {
+			if err := p.SetLocator(c.Locator); err != nil {
+				return nil, nil, err
+			}
+		}
+		if c.Travel == nil {
+			return p.Node, nil, nil
+		}
+		return p.Node, func() error { return p.Travel(c.Travel.From, c.Travel.To) }, nil
+	case roleRebalancer:
+		r := v2.NewRebalancer(o, c.Stations...)
+		if c.Rebalance != nil {
+			policy, err := c.Rebalance.NewPolicy()
+			if err != nil {
+				return nil, nil, err
+			}
+			r.SetPolicy(policy)
+		}
+		return r.Node, func() error {
+			r.Run(nil)
+			return nil
+		}, nil
+	case roleRenter:
+		r := v2.NewRenter(o, c.Stations...)
+		if c.Pricing != nil {
+			pricing, err := c.Pricing.NewStrategy()
+			if err != nil {
+				return nil, nil, err
+			}
+			r.SetPricing(pricing)
+		}
+		if c.Seller != nil {
+			r.SetNegotiation(*c.Seller)
+		}
+		if c.ReservationTTL != "" {
+			ttl, err := time.ParseDuration(c.ReservationTTL)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Invalid reservation TTL: '%s'", c.ReservationTTL)
+			}
+			r.SetReservationTTL(ttl)
+		}
+		return r.Node, nil, nil
+	case roleStation:
+		s := v2.NewStation(o, c.Coords)
+		s.SetDocks(c.Docks)
+		if c.Locator == "" {
+			return s.Node, nil, nil
+		}
+		return s.Node, func() error { return s.Register(c.Locator, c.Operator) }, nil
+	case roleTransport:
+		t := v2.NewTransport(o, c.Stations...)
+		t.SetPosition(c.Coords)
+		t.SetVehicle(c.Capacity, c.Speed)
+		return t.Node, nil, nil
+	case roleUniversity:
+		u := v2.NewUniversity(o, c.Stations[0])
+		if c.Request == nil {
+			return u.Node, nil, nil
+		}
+		in, err := time.ParseDuration(c.Request.In)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid request time: '%s'", c.Request.In)
+		}
+		return u.Node, func() error {
+			_, err := u.RequestBikes(c.Request.Bikes, o.Clock.Now().Add(in))
+			return err
+		}, nil
+	}
+	return nil, nil, fmt.Errorf("Unknown role '%s'", c.Role)
+}
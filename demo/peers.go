@@ -0,0 +1,30 @@
+package demo
+
+import (
+	"sort"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/nahs"
+)
+
+// FindContacts returns every contact of a node that plays a role in
+// a protocol, sorted by ID. The FindContact method of the node only
+// returns the first contact offering the protocol, whatever its roles.
+func FindContacts(n *nahs.Node, protocolKey string, role bspl.Role) []peer.ID {
+	ids := make([]peer.ID, 0)
+	for id, services := range n.Contacts {
+		service, found := services[protocolKey]
+		if !found {
+			continue
+		}
+		for _, r := range service.Roles {
+			if r == role {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
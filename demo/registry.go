@@ -0,0 +1,162 @@
+package demo
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl"
+
+	"github.com/mikelsr/nahs-demo/protocols"
+)
+
+// ProtocolsEnv is the environment variable the binaries read the
+// directory of LoadProtocols from
+const ProtocolsEnv = "NAHS_PROTOCOLS"
+
+const protocolExt = ".bspl"
+
+// Registry of protocols and their schemas
+type Registry struct {
+	byFile  map[string]string
+	byName  map[string]bspl.Protocol
+	byKey   map[string]bspl.Protocol
+	schemas map[string]Schema
+}
+
+// Protocols is the registry of the embedded protocols
+var Protocols = embeddedRegistry()
+
+// embeddedRegistry panics only if the embedded files are malformed,
+// which the tests of the package catch
+func embeddedRegistry() *Registry {
+	r, err := NewRegistry(protocols.FS)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// LoadProtocols builds the registry of the embedded protocols with the
+// protocol and schema files of a directory replacing the ones with the
+// same file name or adding to them
+func LoadProtocols(dir string) (*Registry, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return NewRegistry(protocols.FS, os.DirFS(dir))
+}
+
+// NewRegistry loads the protocols of the ".bspl" files at the root of
+// each file system and the schemas of the ".schema.json" files next to
+// them. The files of each file system replace the ones with the same
+// name in the previous ones.
+func NewRegistry(layers ...fs.FS) (*Registry, error) {
+	files := make(map[string][]byte)
+	for _, fsys := range layers {
+		entries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || !(strings.HasSuffix(name, protocolExt) || strings.HasSuffix(name, schemaSuffix)) {
+				continue
+			}
+			if files[name], err = fs.ReadFile(fsys, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r := &Registry{
+		byFile:  make(map[string]string),
+		byName:  make(map[string]bspl.Protocol),
+		byKey:   make(map[string]bspl.Protocol),
+		schemas: make(map[string]Schema),
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasSuffix(name, protocolExt) {
+			continue
+		}
+		p, err := parseProtocol(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if _, found := r.byName[p.Name]; found {
+			return nil, fmt.Errorf("%s: Protocol '%s' already registered", name, p.Name)
+		}
+		s := make(Schema)
+		schemaName := strings.TrimSuffix(name, protocolExt) + schemaSuffix
+		if data, found := files[schemaName]; found {
+			if s, err = ParseSchema(p, data); err != nil {
+				return nil, fmt.Errorf("%s: %s", schemaName, err)
+			}
+		}
+		r.byFile[name] = p.Key()
+		r.byName[p.Name] = p
+		r.byKey[p.Key()] = p
+		r.schemas[p.Key()] = s
+	}
+	for _, name := range names {
+		if base := strings.TrimSuffix(name, schemaSuffix); base != name {
+			if _, found := r.byFile[base+protocolExt]; !found {
+				return nil, fmt.Errorf("%s: No protocol file", name)
+			}
+		}
+	}
+	return r, nil
+}
+
+// parseProtocol recovers from the panics of the parser on malformed
+// protocols
+func parseProtocol(data []byte) (p bspl.Protocol, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Malformed protocol: %v", r)
+		}
+	}()
+	return bspl.Parse(bytes.NewReader(data))
+}
+
+// List the protocols of the registry by name
+func (r *Registry) List() []bspl.Protocol {
+	list := make([]bspl.Protocol, 0, len(r.byName))
+	for _, p := range r.byName {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get a protocol by its name, e.g. "BikeRental"
+func (r *Registry) Get(name string) (bspl.Protocol, bool) {
+	p, found := r.byName[name]
+	return p, found
+}
+
+// GetByKey gets a protocol by its key
+func (r *Registry) GetByKey(key string) (bspl.Protocol, bool) {
+	p, found := r.byKey[key]
+	return p, found
+}
+
+// GetByFile gets a protocol by the name of its file, e.g. "bike_rental.bspl"
+func (r *Registry) GetByFile(filename string) (bspl.Protocol, bool) {
+	return r.GetByKey(r.byFile[path.Base(filename)])
+}
+
+// Schema of the protocol with the given key, empty if the protocol
+// has no schema file
+func (r *Registry) Schema(key string) (Schema, bool) {
+	s, found := r.schemas[key]
+	return s, found
+}
@@ -0,0 +1,92 @@
+package demo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mikelsr/nahs-demo/protocols"
+)
+
+func TestRegistry(t *testing.T) {
+	rental := GetProtocol(bikeRentalFile)
+	if p, found := Protocols.Get("BikeRental"); !found || p.Key() != rental.Key() {
+		t.Errorf("BikeRental not found by name")
+	}
+	if _, found := Protocols.GetByKey(rental.Key()); !found {
+		t.Errorf("BikeRental not found by key")
+	}
+	list := Protocols.List()
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Name >= list[i].Name {
+			t.Errorf("Protocols not listed by name: %s, %s", list[i-1].Name, list[i].Name)
+		}
+	}
+
+	// the files of an override replace the embedded ones and add to them
+	override := fstest.MapFS{
+		"ping.bspl": &fstest.MapFile{Data: []byte(`Ping {
+        role A, B
+        parameter out ID key, out n
+
+        A -> B: ping[out ID key, out n]
+}`)},
+		"ping.schema.json":      &fstest.MapFile{Data: []byte(`{"n": {"type": "int"}}`)},
+		"bike_ride.schema.json": &fstest.MapFile{Data: []byte(`{}`)},
+	}
+	r, err := NewRegistry(protocols.FS, override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.List()) != len(list)+1 {
+		t.Errorf("Expected %d protocols, got %d", len(list)+1, len(r.List()))
+	}
+	ping, found := r.Get("Ping")
+	if !found {
+		t.Fatal("Ping not found")
+	}
+	if s, _ := r.Schema(ping.Key()); s["n"].Type != IntParam {
+		t.Errorf("Unexpected Ping schema: %v", s)
+	}
+	ride, _ := r.GetByFile("bike_ride.bspl")
+	if s, _ := r.Schema(ride.Key()); len(s) != 0 {
+		t.Errorf("Schema of BikeRide not replaced: %v", s)
+	}
+
+	invalid := []fstest.MapFS{
+		// a protocol registered twice
+		{"rental.bspl": override["ping.bspl"], "ping.bspl": override["ping.bspl"]},
+		// a schema without a protocol
+		{"pong.schema.json": override["ping.schema.json"]},
+		{"ping.bspl": &fstest.MapFile{Data: []byte("Ping {")}},
+	}
+	for _, fsys := range invalid {
+		if _, err := NewRegistry(fsys); err == nil {
+			t.Errorf("Invalid protocols registered: %v", fsys)
+		}
+	}
+}
+
+func TestLoadProtocols(t *testing.T) {
+	dir := t.TempDir()
+	schema := []byte(`{"bikeID": {"type": "string"}}`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "bike_rental.schema.json"), schema, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadProtocols(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rental, _ := r.GetByFile(bikeRentalFile)
+	if s, _ := r.Schema(rental.Key()); len(s) != 1 || s["bikeID"].Type != StringParam {
+		t.Errorf("Schema of BikeRental not replaced: %v", s)
+	}
+	// the embedded registry is left as it was
+	if s := GetSchema(bikeRentalFile); s["bikeID"].Type != PeerParam {
+		t.Errorf("Embedded schema of BikeRental replaced: %v", s)
+	}
+	if _, err := LoadProtocols(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Missing directory loaded")
+	}
+}
@@ -0,0 +1,149 @@
+package demo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikelsr/bspl"
+)
+
+// ParamType is the type of the values of a protocol parameter
+type ParamType string
+
+const (
+	// StringParam values are taken as they are, the default
+	StringParam ParamType = "string"
+	// IntParam values are decimal integers
+	IntParam ParamType = "int"
+	// FloatParam values are decimal numbers
+	FloatParam ParamType = "float"
+	// TimeParam values are RFC 3339 timestamps
+	TimeParam ParamType = "time"
+	// CoordsParam values are geo URIs
+	CoordsParam ParamType = "coords"
+	// PeerParam values are base58 peer IDs
+	PeerParam ParamType = "peer"
+)
+
+var paramTypes = map[ParamType]bool{
+	StringParam: true, IntParam: true, FloatParam: true,
+	TimeParam: true, CoordsParam: true, PeerParam: true,
+}
+
+// schemaSuffix replaces the extension of a protocol file in the name
+// of its schema file
+const schemaSuffix = ".schema.json"
+
+// ParamSchema annotates a protocol parameter
+type ParamSchema struct {
+	Type ParamType `json:"type"`
+	// Unit of the values, e.g. "€", informative only
+	Unit string `json:"unit,omitempty"`
+	// Min and Max bound the values of numeric parameters, if set
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Enum lists the values allowed for a string parameter, if set
+	Enum []string `json:"enum,omitempty"`
+}
+
+// Validate the annotations of a parameter
+func (s ParamSchema) Validate() error {
+	if !paramTypes[s.Type] {
+		return fmt.Errorf("Unknown type '%s'", s.Type)
+	}
+	numeric := s.Type == IntParam || s.Type == FloatParam
+	if (s.Min != nil || s.Max != nil) && !numeric {
+		return fmt.Errorf("Range of non-numeric type '%s'", s.Type)
+	}
+	if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+		return fmt.Errorf("Empty range [%g, %g]", *s.Min, *s.Max)
+	}
+	if len(s.Enum) > 0 && s.Type != StringParam {
+		return fmt.Errorf("Enum of non-string type '%s'", s.Type)
+	}
+	return nil
+}
+
+// Check a value against the range or the enum of the parameter. The
+// value is expected to be of the type of the parameter.
+func (s ParamSchema) Check(value string) error {
+	if len(s.Enum) > 0 {
+		for _, v := range s.Enum {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("'%s' not one of %s", value, strings.Join(s.Enum, ", "))
+	}
+	if s.Min == nil && s.Max == nil {
+		return nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("'%s' not a number", value)
+	}
+	if s.Min != nil && n < *s.Min {
+		return fmt.Errorf("%s below the minimum %g", value, *s.Min)
+	}
+	if s.Max != nil && n > *s.Max {
+		return fmt.Errorf("%s above the maximum %g", value, *s.Max)
+	}
+	return nil
+}
+
+// Schema annotates the parameters of a protocol, the ones not listed
+// are plain strings
+type Schema map[string]ParamSchema
+
+// Validate the schema of a protocol
+func (s Schema) Validate(p bspl.Protocol) error {
+	params := make(map[string]bool)
+	for _, param := range p.Params {
+		params[param.Name] = true
+	}
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !params[name] {
+			return fmt.Errorf("Unknown parameter '%s' of %s", name, p.Name)
+		}
+		if err := s[name].Validate(); err != nil {
+			return fmt.Errorf("Parameter '%s' of %s: %s", name, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// ParseSchema reads the schema of a protocol from a JSON object of
+// parameter annotations
+func ParseSchema(p bspl.Protocol, data []byte) (Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	for name, param := range s {
+		if param.Type == "" {
+			param.Type = StringParam
+			s[name] = param
+		}
+	}
+	if err := s.Validate(p); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSchema gets the schema of the protocol of the corresponding file
+// from the registry of demo protocols, e.g. the schema in
+// "bike_ride.schema.json" for "bike_ride.bspl". Protocols without a
+// schema file have an empty one.
+func GetSchema(filename string) Schema {
+	s, _ := Protocols.Schema(GetProtocol(filename).Key())
+	return s
+}
@@ -0,0 +1,57 @@
+package demo
+
+import (
+	"testing"
+)
+
+func TestGetSchema(t *testing.T) {
+	s := GetSchema(bikeRentalFile)
+	if price := s["price"]; price.Type != FloatParam || price.Unit != "€" || price.Min == nil {
+		t.Errorf("Unexpected price schema: %+v", price)
+	}
+	if rID := s["rID"]; rID.Type != StringParam || len(rID.Enum) != 2 {
+		t.Errorf("Unexpected rID schema: %+v", rID)
+	}
+	// protocols without a schema file
+	if s := GetSchema("bike_storage.bspl"); len(s) != 0 {
+		t.Errorf("Expected an empty schema, got %v", s)
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	p := GetProtocol(bikeRentalFile)
+	invalid := []string{
+		`{"distance": {"type": "float"}}`,
+		`{"price": {"type": "money"}}`,
+		`{"price": {"type": "float", "min": 1, "max": 0}}`,
+		`{"origin": {"type": "peer", "min": 0}}`,
+		`{"price": {"type": "float", "enum": ["1"]}}`,
+		`{"price": "float"}`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseSchema(p, []byte(data)); err == nil {
+			t.Errorf("Invalid schema parsed: %s", data)
+		}
+	}
+}
+
+func TestParamSchema_Check(t *testing.T) {
+	min, max := 1.0, 3.0
+	tests := []struct {
+		s     ParamSchema
+		value string
+		valid bool
+	}{
+		{ParamSchema{Type: IntParam, Min: &min, Max: &max}, "1", true},
+		{ParamSchema{Type: IntParam, Min: &min, Max: &max}, "0", false},
+		{ParamSchema{Type: FloatParam, Min: &min, Max: &max}, "3.5", false},
+		{ParamSchema{Type: FloatParam}, "-7", true},
+		{ParamSchema{Type: StringParam, Enum: []string{"accept", "reject"}}, "reject", true},
+		{ParamSchema{Type: StringParam, Enum: []string{"accept", "reject"}}, "maybe", false},
+	}
+	for _, test := range tests {
+		if err := test.s.Check(test.value); (err == nil) != test.valid {
+			t.Errorf("%+v checking '%s': expected valid %t, got %v", test.s, test.value, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package demo
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mikelsr/bspl"
+)
+
+// InstanceState is the state of an instance kept in an InstanceStore
+type InstanceState int
+
+const (
+	// InstanceOpen instances are still being enacted
+	InstanceOpen InstanceState = iota
+	// InstanceDropped instances were cancelled by one of the parties
+	InstanceDropped
+	// InstanceCompleted instances reached the end of their protocol
+	InstanceCompleted
+)
+
+func (s InstanceState) String() string {
+	switch s {
+	case InstanceOpen:
+		return "open"
+	case InstanceDropped:
+		return "dropped"
+	case InstanceCompleted:
+		return "completed"
+	}
+	return fmt.Sprintf("InstanceState(%d)", int(s))
+}
+
+// InstanceStore keeps the protocol instances of an agent along with
+// the state of each of them. It is safe for concurrent use.
+type InstanceStore struct {
+	mutex     sync.RWMutex
+	instances map[string]bspl.Instance
+	states    map[string]InstanceState
+}
+
+// NewInstanceStore is the default constructor for InstanceStore
+func NewInstanceStore() *InstanceStore {
+	return &InstanceStore{
+		instances: make(map[string]bspl.Instance),
+		states:    make(map[string]InstanceState),
+	}
+}
+
+// Add an open instance to the store. An instance can't be added twice.
+func (s *InstanceStore) Add(i bspl.Instance) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, found := s.instances[i.Key()]; found {
+		return fmt.Errorf("Instance '%s' already existed", i.Key())
+	}
+	s.instances[i.Key()] = i
+	s.states[i.Key()] = InstanceOpen
+	return nil
+}
+
+// Get an open instance given the instance key
+func (s *InstanceStore) Get(instanceKey string) (bspl.Instance, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.states[instanceKey] != InstanceOpen {
+		return nil, false
+	}
+	i, found := s.instances[instanceKey]
+	return i, found
+}
+
+// State of an instance given the instance key
+func (s *InstanceStore) State(instanceKey string) (InstanceState, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	state, found := s.states[instanceKey]
+	return state, found
+}
+
+// Drop marks an open instance as dropped
+func (s *InstanceStore) Drop(instanceKey string) error {
+	return s.close(instanceKey, InstanceDropped)
+}
+
+// Complete marks an open instance as completed
+func (s *InstanceStore) Complete(instanceKey string) error {
+	return s.close(instanceKey, InstanceCompleted)
+}
+
+func (s *InstanceStore) close(instanceKey string, state InstanceState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	current, found := s.states[instanceKey]
+	if !found || current != InstanceOpen {
+		return fmt.Errorf("Instance '%s' not found", instanceKey)
+	}
+	s.states[instanceKey] = state
+	return nil
+}
+
+// Instances of a protocol in any of the given states. If no state
+// is given, only the open instances are returned.
+func (s *InstanceStore) Instances(protocolKey string, states ...InstanceState) []bspl.Instance {
+	if len(states) == 0 {
+		states = []InstanceState{InstanceOpen}
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	instances := make([]bspl.Instance, 0)
+	for key, i := range s.instances {
+		if i.Protocol().Key() != protocolKey {
+			continue
+		}
+		for _, state := range states {
+			if s.states[key] == state {
+				instances = append(instances, i)
+				break
+			}
+		}
+	}
+	return instances
+}
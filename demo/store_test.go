@@ -0,0 +1,122 @@
+package demo
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/net"
+)
+
+func testInstance(id string) bspl.Instance {
+	i := imp.NewInstance(GetProtocol(bikeRentalFile), bspl.Roles{})
+	i.SetValue("ID", id)
+	return i
+}
+
+func TestInstanceStore(t *testing.T) {
+	s := NewInstanceStore()
+	i := testInstance("a")
+	if err := s.Add(i); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := s.Add(i); err == nil {
+		t.Error("Added the same instance twice")
+	}
+	if _, found := s.Get(i.Key()); !found {
+		t.Errorf("Instance '%s' not found", i.Key())
+	}
+	if err := s.Drop(i.Key()); err != nil {
+		t.Error(err)
+	}
+	if _, found := s.Get(i.Key()); found {
+		t.Errorf("Dropped instance '%s' still open", i.Key())
+	}
+	if err := s.Drop(i.Key()); err == nil {
+		t.Error("Dropped the same instance twice")
+	}
+}
+
+func TestInstanceStore_Instances(t *testing.T) {
+	s := NewInstanceStore()
+	rental := GetProtocol(bikeRentalFile)
+	search := GetProtocol("station_search.bspl")
+	for _, id := range []string{"open", "dropped", "completed"} {
+		s.Add(testInstance(id))
+	}
+	other := imp.NewInstance(search, bspl.Roles{})
+	other.SetValue("ID", "other")
+	s.Add(other)
+	s.Drop(testInstance("dropped").Key())
+	s.Complete(testInstance("completed").Key())
+
+	if n := len(s.Instances(rental.Key())); n != 1 {
+		t.Errorf("Expected 1 open instance, found %d", n)
+	}
+	if n := len(s.Instances(rental.Key(), InstanceDropped, InstanceCompleted)); n != 2 {
+		t.Errorf("Expected 2 closed instances, found %d", n)
+	}
+	if n := len(s.Instances(search.Key())); n != 1 {
+		t.Errorf("Expected 1 open instance of '%s', found %d", search.Key(), n)
+	}
+	if state, _ := s.State(testInstance("completed").Key()); state != InstanceCompleted {
+		t.Errorf("Expected state '%s', found '%s'", InstanceCompleted, state)
+	}
+	if _, found := s.Get(testInstance("completed").Key()); found {
+		t.Error("Completed instances must not be returned as open")
+	}
+}
+
+// run with -race
+func TestInstanceStore_Concurrent(t *testing.T) {
+	s := NewInstanceStore()
+	n := 50
+	var wg sync.WaitGroup
+	for k := 0; k < n; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			i := testInstance(fmt.Sprint(k))
+			if err := s.Add(i); err != nil {
+				t.Error(err)
+				return
+			}
+			s.Get(i.Key())
+			s.Instances(i.Protocol().Key())
+			if k%2 == 0 {
+				if err := s.Drop(i.Key()); err != nil {
+					t.Error(err)
+				}
+			}
+		}(k)
+	}
+	wg.Wait()
+	if open := len(s.Instances(GetProtocol(bikeRentalFile).Key())); open != n/2 {
+		t.Errorf("Expected %d open instances, found %d", n/2, open)
+	}
+}
+
+func TestFindContacts(t *testing.T) {
+	nodes := make([]*nahs.Node, 4)
+	for k := range nodes {
+		nodes[k] = net.LocalNode(nil)
+	}
+	p := GetProtocol(bikeRentalFile)
+	node := nodes[0]
+	node.AddContact(nodes[1].ID(), net.Service{Roles: []bspl.Role{"Renter"}, Protocol: p})
+	node.AddContact(nodes[2].ID(), net.Service{Roles: []bspl.Role{"Renter"}, Protocol: p})
+	node.AddContact(nodes[3].ID(), net.Service{Roles: []bspl.Role{"Customer"}, Protocol: p})
+	renters := FindContacts(node, p.Key(), "Renter")
+	if len(renters) != 2 || renters[0] > renters[1] {
+		t.Fatalf("Expected two sorted renters, found %v", renters)
+	}
+	for _, id := range renters {
+		if id == nodes[3].ID() {
+			t.Error("Found a contact playing another role")
+		}
+	}
+}
@@ -1,47 +1,32 @@
 package demo
 
 import (
-	"errors"
-	"os"
-	"path/filepath"
-	"runtime"
-	"strings"
+	"fmt"
 
 	peerstore "github.com/libp2p/go-libp2p-peerstore"
 	"github.com/mikelsr/bspl"
 	"github.com/mikelsr/nahs"
 )
 
-func getProtoFolder() (string, error) {
-	_, fileName, _, ok := runtime.Caller(1)
-	if !ok {
-		return "", errors.New("Failed to locate project")
-	}
-	dir, err := filepath.Abs(filepath.Dir(fileName))
-	if err != nil {
-		return "", err
+// GetProtocol gets the protocol of the corresponding file from the
+// registry of demo protocols
+func GetProtocol(filename string) bspl.Protocol {
+	p, found := Protocols.GetByFile(filename)
+	if !found {
+		panic(fmt.Errorf("Protocol file '%s' not found", filename))
 	}
-	path := strings.Split(dir, string(os.PathSeparator))
-	dir = "/" + filepath.Join(path[:len(path)-1]...)
-	return filepath.Join(dir, "protocols"), nil
+	return p
 }
 
-// GetProtocol builds a protocol from the corresponding file
-// in the demo protocol folder
-func GetProtocol(filename string) bspl.Protocol {
-	folder, err := getProtoFolder()
-	if err != nil {
-		panic(err)
-	}
-	reader, err := os.Open(filepath.Join(folder, filename))
-	if err != nil {
-		panic(err)
-	}
-	p, err := bspl.Parse(reader)
-	if err != nil {
-		panic(err)
+// HasAction is whether an action with the given name is among the ones
+// that may have run between two versions of an instance
+func HasAction(actions []bspl.Action, name string) bool {
+	for _, a := range actions {
+		if a.Name == name {
+			return true
+		}
 	}
-	return p
+	return false
 }
 
 // IntroduceNodes stores the contact information of each node in
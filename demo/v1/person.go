@@ -3,14 +3,20 @@ package v1
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/mikelsr/bspl"
 	imp "github.com/mikelsr/bspl/implementation"
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 type offer struct {
@@ -18,12 +24,14 @@ type offer struct {
 	instanceKey string
 }
 
+// offerDeadline is the time a person waits for the offers of the renters
+const offerDeadline = 2 * time.Second
+
 // Person is a NaHS agent representing a single person
 type Person struct {
-	maxPrice  float64 // maximum €/min a person is willing to pay for a bike
-	node      *nahs.Node
-	reasoner  *personReasoner
-	responses chan bool
+	maxPrice float64 // maximum €/min a person is willing to pay for a bike
+	node     *nahs.Node
+	reasoner *personReasoner
 }
 
 // NewPerson creates a new Person NaHS agent
@@ -33,78 +41,140 @@ func NewPerson(maxPrice float64) Person {
 	p.reasoner = newPersonReasoner()
 	//p.node = nahs.NewNode(p.reasoner)
 	p.node = net.LocalNode(p.reasoner)
-	p.responses = make(chan bool)
-
-	go p.handleOffers()
 
 	logger.Debugf("Created person with ID: '%s'", p.node.ID())
 	return p
 }
 
-// RentBike looks for a node that plays the Renter role in the
-// Bike Rental protocol and requests it
+// RentBike requests a bike to every node that plays the Renter role
+// in the Bike Rental protocol, accepts the cheapest offer received
+// before the deadline if affordable and rejects the others
 func (p Person) RentBike(origin, destination string) (string, error) {
-	protocol := bikeRentalProtocol
-	key := protocol.Key()
-	renters := p.node.FindContact(key, "Renter")
+	renters := demo.FindContacts(p.node, bikeRentalProtocol.Key(), "Renter")
 	if len(renters) == 0 {
 		return "", errors.New("No renters found")
 	}
-	id := renters[0]
+	offers := make(chan offer, len(renters))
+	sent := make(chan string, len(renters))
+	for _, id := range renters {
+		go func(id peer.ID) {
+			key, err := p.requestBike(id, origin, destination, offers)
+			if err != nil {
+				logger.Error(err)
+			}
+			sent <- key
+		}(id)
+	}
+	keys := make([]string, 0, len(renters))
+	for range renters {
+		if key := <-sent; key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "", errors.New("No renter accepted the request")
+	}
+
+	received := make([]offer, 0, len(keys))
+	deadline := time.After(offerDeadline)
+collect:
+	for len(received) < len(keys) {
+		select {
+		case o := <-offers:
+			received = append(received, o)
+		case <-deadline:
+			break collect
+		}
+	}
+	// offers arriving from now on are ignored
+	p.reasoner.forget(keys...)
+	if len(received) == 0 {
+		return "", errors.New("The renters did not reply")
+	}
+
+	sort.SliceStable(received, func(i, j int) bool { return received[i].price < received[j].price })
+	best := received[0]
+	accepted := best.price <= p.maxPrice
+	if accepted {
+		logger.Infof("Accepted offer for price '%.2f'", best.price)
+	} else {
+		logger.Infof("Rejected offers, the cheapest for price '%.2f'", best.price)
+	}
+	err := p.answer(best.instanceKey, accepted)
+	for _, o := range received[1:] {
+		if err := p.answer(o.instanceKey, false); err != nil {
+			logger.Error(err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if !accepted {
+		return "", errors.New("Bike found but rejected")
+	}
+	instance, found := p.reasoner.GetInstance(best.instanceKey)
+	if !found {
+		return "", fmt.Errorf("Instance '%s' not found", best.instanceKey)
+	}
+	bikeID := instance.GetValue("bikeID")
+	logger.Infof("Rented bike with ID '%s'", bikeID)
+	return bikeID, nil
+}
+
+// requestBike requests a bike to a renter and returns the key of the
+// instance, the offer is sent through offers
+func (p Person) requestBike(id peer.ID, origin, destination string, offers chan offer) (string, error) {
 	roles := bspl.Roles{"Client": p.node.ID().Pretty(), "Renter": id.Pretty()}
 	inputs := bspl.Values{"in origin": origin, "in destination": destination}
-	instance, err := p.reasoner.Instantiate(protocol, roles, inputs)
+	instance, err := p.reasoner.Instantiate(bikeRentalProtocol, roles, inputs)
 	if err != nil {
 		return "", err
 	}
-	p.node.OpenInstances[instance.Key()] = id
+	// the instance is updated concurrently once it is sent
+	key := instance.Key()
+	p.node.SetInstancePeer(key, id)
+	// the offer may arrive before the event is acknowledged
+	p.reasoner.await(key, offers)
 	event := events.MakeNewEvent(instance)
 	ok, err := p.node.SendEvent(id, event)
+	if err == nil && !ok {
+		err = fmt.Errorf("Instance already existed in renter node")
+	}
 	if err != nil {
+		p.reasoner.forget(key)
 		return "", err
 	}
-	if !ok {
-		return "", fmt.Errorf("Instance already existed in renter node")
-	}
-	ok = <-p.responses
-	if ok {
-		bikeID := instance.GetValue("bikeID")
-		logger.Infof("Rented bike with ID '%s'", bikeID)
-		return bikeID, nil
-	}
-	return "", errors.New("The renter did not reply")
-}
-
-func (p Person) handleOffers() {
-	for {
-		o := <-p.reasoner.offers
-		target := p.node.OpenInstances[o.instanceKey]
-		instance := p.reasoner.openInstances[o.instanceKey]
-		var rID string
-		if o.price > p.maxPrice {
-			logger.Infof("Rejected offer from '%s' for price '%.2f'",
-				target, o.price)
-			rID = "reject"
-		} else {
-			logger.Infof("Accepted offer from '%s' for price '%.2f'",
-				target, o.price)
-			rID = "accept"
-		}
-		instance.SetValue("rID", rID)
-		event := events.MakeUpdateEvent(instance)
-		ok, _ := p.node.SendEvent(target, event)
-		p.responses <- ok
+	return key, nil
+}
+
+// answer an offer accepting or rejecting it
+func (p Person) answer(instanceKey string, accept bool) error {
+	target, _ := p.node.InstancePeer(instanceKey)
+	instance, found := p.reasoner.GetInstance(instanceKey)
+	if !found {
+		return fmt.Errorf("Instance '%s' not found", instanceKey)
+	}
+	rID := "reject"
+	if accept {
+		rID = "accept"
+		instance.SetValue("agreed", instance.GetValue("price"))
 	}
+	instance.SetValue("rID", rID)
+	event := events.MakeUpdateEvent(instance)
+	_, err := p.node.SendEvent(target, event)
+	return err
 }
 
 type personReasoner struct {
 	offeredServices  map[string]bspl.Protocol
 	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+	instances        *demo.InstanceStore
 
 	dropInstanceChan chan string
-	offers           chan offer
+	// offers maps the instances waiting for an offer to the channel
+	// the offer is sent through
+	offers map[string]chan offer
+	mutex  sync.Mutex
 }
 
 func newPersonReasoner() *personReasoner {
@@ -112,11 +182,10 @@ func newPersonReasoner() *personReasoner {
 
 	p.offeredServices = make(map[string]bspl.Protocol)
 	p.consumedServices = make(map[string]bspl.Protocol)
-	p.openInstances = make(map[string]bspl.Instance)
-	p.droppedInstances = make(map[string]bspl.Instance)
+	p.instances = demo.NewInstanceStore()
 
 	p.dropInstanceChan = make(chan string)
-	p.offers = make(chan offer)
+	p.offers = make(map[string]chan offer)
 
 	p.consumedServices[bikeRentalProtocol.Key()] = bikeRentalProtocol
 
@@ -124,28 +193,15 @@ func newPersonReasoner() *personReasoner {
 }
 
 func (pr *personReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := pr.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
-	}
-	pr.droppedInstances[instanceKey] = instance
-	delete(pr.openInstances, instanceKey)
-	return nil
+	return pr.instances.Drop(instanceKey)
 }
 
 func (pr *personReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	instance, found := pr.openInstances[instanceKey]
-	return instance, found
+	return pr.instances.Get(instanceKey)
 }
 
 func (pr *personReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	instances := make([]bspl.Instance, len(pr.openInstances))
-	i := 0
-	for _, v := range pr.openInstances {
-		instances[i] = v
-		i++
-	}
-	return instances
+	return pr.instances.Instances(p.Key())
 }
 
 func (pr *personReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
@@ -164,7 +220,7 @@ func (pr *personReasoner) RegisterInstance(i bspl.Instance) error {
 }
 
 func (pr *personReasoner) UpdateInstance(j bspl.Instance) error {
-	i, found := pr.openInstances[j.Key()]
+	i, found := pr.instances.Get(j.Key())
 	if !found {
 		return fmt.Errorf("Instance not found: '%s'", j.Key())
 	}
@@ -182,10 +238,34 @@ func (pr *personReasoner) UpdateInstance(j bspl.Instance) error {
 		return err
 	}
 	logger.Infof("Received offer for price: '%.2f'", price)
-	pr.offers <- offer{instanceKey: i.Key(), price: price}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	offers, found := pr.offers[i.Key()]
+	if !found {
+		return fmt.Errorf("No pending offer for instance '%s'", i.Key())
+	}
+	delete(pr.offers, i.Key())
+	// buffered for every renter
+	offers <- offer{instanceKey: i.Key(), price: price}
 	return nil
 }
 
+// await the offer for an instance
+func (pr *personReasoner) await(instanceKey string, offers chan offer) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.offers[instanceKey] = offers
+}
+
+// forget the offers not received yet for the instances
+func (pr *personReasoner) forget(instanceKeys ...string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	for _, key := range instanceKeys {
+		delete(pr.offers, key)
+	}
+}
+
 func (pr *personReasoner) instantiateBikeRental(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
 	id := uuid.New().String()
 	params := make(map[string]string)
@@ -202,6 +282,8 @@ func (pr *personReasoner) instantiateBikeRental(roles bspl.Roles, values bspl.Va
 	i.SetValue("ID", id)
 	i.SetValue("destination", params["in destination"])
 	i.SetValue("origin", params["in origin"])
-	pr.openInstances[i.Key()] = i
+	if err := pr.instances.Add(i); err != nil {
+		return nil, err
+	}
 	return i, nil
 }
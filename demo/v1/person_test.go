@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"math/rand"
 	"testing"
 
 	log "github.com/ipfs/go-log"
@@ -17,8 +18,10 @@ func TestMain(m *testing.M) {
 }
 
 func TestPerson_RentBike(t *testing.T) {
+	defer func(p []float64) { prices = p }(prices)
+	prices = []float64{0.02}
 	person := NewPerson(0.02)
-	renter := NewRenter()
+	renter := NewRenter(rand.New(rand.NewSource(1)))
 
 	person.node.Peerstore().AddAddrs(renter.node.ID(), renter.node.Addrs(), peerstore.PermanentAddrTTL)
 
@@ -29,3 +32,33 @@ func TestPerson_RentBike(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPerson_RentBike_cheapest(t *testing.T) {
+	defer func(p []float64) { prices = p }(prices)
+	person := NewPerson(0.02)
+	renters := make([]Renter, 2)
+	for k, price := range []float64{0.03, 0.01} {
+		prices = []float64{price}
+		renters[k] = NewRenter(rand.New(rand.NewSource(int64(k))))
+	}
+	for _, renter := range renters {
+		person.node.Peerstore().AddAddrs(renter.node.ID(), renter.node.Addrs(), peerstore.PermanentAddrTTL)
+		person.node.AddContact(renter.node.ID(), bikeRenterService)
+	}
+
+	if _, err := person.RentBike(zoneA, zoneB); err != nil {
+		t.Fatal(err)
+	}
+	for k, expected := range []string{"reject", "accept"} {
+		instances := person.reasoner.instances.Instances(bikeRentalProtocol.Key())
+		var rID string
+		for _, i := range instances {
+			if i.Roles()["Renter"] == renters[k].node.ID().Pretty() {
+				rID = i.GetValue("rID")
+			}
+		}
+		if rID != expected {
+			t.Errorf("Expected renter %d to get '%s', got '%s'", k, expected, rID)
+		}
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"time"
+	"sync"
 
 	"github.com/mikelsr/bspl"
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 var prices = []float64{0.01, 0.02, 0.03}
@@ -17,14 +19,17 @@ var prices = []float64{0.01, 0.02, 0.03}
 // Renter is a NaHS agent that rents bikes to Clients.
 type Renter struct {
 	prices   []float64
+	random   *rand.Rand
 	node     *nahs.Node
 	reasoner *renterReasoner
 }
 
-// NewRenter creates a new Renter NaHS agents
-func NewRenter() Renter {
+// NewRenter creates a new Renter NaHS agents that picks the price of
+// each offer with random
+func NewRenter(random *rand.Rand) Renter {
 	r := Renter{}
 	r.prices = prices
+	r.random = random
 
 	// the cycle of life
 	r.reasoner = newRenterReasoner()
@@ -40,9 +45,11 @@ func NewRenter() Renter {
 }
 
 func (r Renter) offerBike(instanceKey string) bool {
-	rand.Seed(time.Now().Unix())
-	// offer a random price to the client
-	price := r.prices[rand.Intn(len(r.prices))]
+	// offer a random price to the client, the random source isn't
+	// safe for concurrent use
+	r.reasoner.mutex.Lock()
+	price := r.prices[r.random.Intn(len(r.prices))]
+	r.reasoner.mutex.Unlock()
 	instance, found := r.reasoner.GetInstance(instanceKey)
 	if !found {
 		err := fmt.Errorf("Instance '%s' not found", instanceKey)
@@ -52,7 +59,7 @@ func (r Renter) offerBike(instanceKey string) bool {
 	instance.SetValue("price", fmt.Sprint(price))
 	instance.SetValue("bikeID", "testBike")
 	event := events.MakeUpdateEvent(instance)
-	target := r.node.OpenInstances[instanceKey]
+	target, _ := r.node.InstancePeer(instanceKey)
 	logger.Infof("Offered Offer bike to '%s'", target)
 	ok, err := r.node.SendEvent(target, event)
 	if err != nil {
@@ -66,7 +73,7 @@ func (r Renter) offerBikes() {
 	for {
 		instanceKey := <-r.reasoner.pendingOffers
 		ok := r.offerBike(instanceKey)
-		target := r.node.OpenInstances[instanceKey]
+		target, _ := r.node.InstancePeer(instanceKey)
 		if ok {
 			logger.Debugf("Success offering bike to '%s'", target)
 		} else {
@@ -78,19 +85,19 @@ func (r Renter) offerBikes() {
 type renterReasoner struct {
 	offeredServices  map[string]bspl.Protocol
 	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+	instances        *demo.InstanceStore
 
 	dropInstanceChan chan string
 	pendingOffers    chan string
+	// mutex guards the random source of the renter
+	mutex sync.Mutex
 }
 
 func newRenterReasoner() *renterReasoner {
 	r := new(renterReasoner)
 	r.offeredServices = make(map[string]bspl.Protocol)
 	r.consumedServices = make(map[string]bspl.Protocol)
-	r.openInstances = make(map[string]bspl.Instance)
-	r.droppedInstances = make(map[string]bspl.Instance)
+	r.instances = demo.NewInstanceStore()
 
 	r.offeredServices[bikeRentalProtocol.Key()] = bikeRentalProtocol
 
@@ -100,28 +107,15 @@ func newRenterReasoner() *renterReasoner {
 }
 
 func (rr *renterReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := rr.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
-	}
-	rr.droppedInstances[instanceKey] = instance
-	delete(rr.openInstances, instanceKey)
-	return nil
+	return rr.instances.Drop(instanceKey)
 }
 
 func (rr *renterReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	instance, found := rr.openInstances[instanceKey]
-	return instance, found
+	return rr.instances.Get(instanceKey)
 }
 
 func (rr *renterReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	instances := make([]bspl.Instance, len(rr.openInstances))
-	i := 0
-	for _, v := range rr.openInstances {
-		instances[i] = v
-		i++
-	}
-	return instances
+	return rr.instances.Instances(p.Key())
 }
 
 func (rr *renterReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
@@ -129,7 +123,7 @@ func (rr *renterReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bsp
 }
 
 func (rr *renterReasoner) UpdateInstance(j bspl.Instance) error {
-	i, found := rr.openInstances[j.Key()]
+	i, found := rr.instances.Get(j.Key())
 	if !found {
 		return fmt.Errorf("Instance '%s' not found", j.Key())
 	}
@@ -137,18 +131,7 @@ func (rr *renterReasoner) UpdateInstance(j bspl.Instance) error {
 	if err != nil {
 		return err
 	}
-	if len(actions) != 2 {
-		return errors.New("Unexpected actions")
-	}
-	if actions[0].Name == "accept" {
-		if actions[1].Name != "reject" {
-			return errors.New("Unexpected actions")
-		}
-	} else if actions[0].Name == "reject" {
-		if actions[1].Name != "reject" {
-			return errors.New("Unexpected actions")
-		}
-	} else {
+	if !demo.HasAction(actions, j.GetValue("rID")) {
 		return errors.New("Unexpected actions")
 	}
 	i.Update(j)
@@ -160,15 +143,14 @@ func (rr *renterReasoner) UpdateInstance(j bspl.Instance) error {
 }
 
 func (rr *renterReasoner) RegisterInstance(i bspl.Instance) error {
-	if _, found := rr.openInstances[i.Key()]; found {
-		return fmt.Errorf("Instance '%s' already existed", i.Key())
-	}
 	// TODO: verify who sends the message and assert the role ID is correct.
 	// This should be done in the library, not the demo.
 	if len(i.Roles()) < 2 {
 		return fmt.Errorf("Missing roles for instance '%s'", i.Key())
 	}
-	rr.openInstances[i.Key()] = i
+	if err := rr.instances.Add(i); err != nil {
+		return err
+	}
 	if i.Protocol().Key() == bikeRentalProtocol.Key() {
 		rr.pendingOffers <- i.Key()
 	}
@@ -4,11 +4,15 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 // Bike is an agent representing a Bike
@@ -21,12 +25,12 @@ type Bike struct {
 }
 
 // NewBike is the default constructor for Bike
-func NewBike() Bike {
+func NewBike(o AgentOptions) Bike {
 	b := Bike{}
 	// the cycle of life
-	b.reasoner = newBikeReasoner()
+	b.reasoner = newBikeReasoner(o)
 	//p.Node = nahs.NewNode(p.reasoner)
-	b.Node = net.LocalNode(b.reasoner)
+	b.Node = net.LocalNode(b.reasoner, NodeOptions...)
 	b.reasoner.Node = b.Node
 	logger.Debugf("\tCreated bike with ID %s (%s)", shortID(b.ID()), b.ID())
 	return b
@@ -37,13 +41,19 @@ func (b Bike) ID() string {
 	return b.Node.ID().Pretty()
 }
 
-type bikeReasoner struct {
-	Node *nahs.Node
+// Instances of a protocol enacted by the bike in any of the given
+// states, or the open ones if no state is given
+func (b Bike) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return b.reasoner.InstancesIn(p, states...)
+}
+
+// Dock the bike at a station
+func (b Bike) Dock(stationID string) error {
+	return b.reasoner.dock(stationID)
+}
 
-	offeredServices  map[string]bspl.Protocol
-	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+type bikeReasoner struct {
+	baseReasoner
 
 	currentRider   peer.ID
 	currentStation string
@@ -51,103 +61,30 @@ type bikeReasoner struct {
 	updateBuffer map[string]bspl.Instance
 }
 
-func newBikeReasoner() *bikeReasoner {
-	b := bikeReasoner{}
-	// initialize maps
-	b.openInstances = make(map[string]bspl.Instance)
-	b.droppedInstances = make(map[string]bspl.Instance)
-	b.consumedServices = make(map[string]bspl.Protocol)
-	// rent bike, ride bike, search for a near station
-	b.offeredServices = map[string]bspl.Protocol{
-		bikeRideProtocol.Key(): bikeRideProtocol,
-	}
+func newBikeReasoner(o AgentOptions) *bikeReasoner {
+	b := &bikeReasoner{baseReasoner: newBaseReasoner(o)}
+	// ride bike
+	b.offer(bikeRideProtocol, b.registerBikeRide, b.updateBikeRide)
+	// dock at stations
+	b.consume(bikeStorageProtocol, b.instantiateBikeStorage, b.updateBikeStorage)
 	b.updateBuffer = make(map[string]bspl.Instance)
-	return &b
-}
-
-// DropInstance cancels an Instance for whatever motive
-func (br *bikeReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := br.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
-	}
-	br.droppedInstances[instanceKey] = instance
-	delete(br.openInstances, instanceKey)
-	return nil
-}
-
-// GetInstance returns an Instance given the instance key
-func (br *bikeReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	return nil, false
-}
-
-// All instances of a Protocol
-func (br *bikeReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	return nil
-}
-
-// Instantiate a protocol. Check if the assigned role is a role
-// the reasoner is willing to play.
-func (br *bikeReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
-	return nil, nil
-}
-
-// RegisterInstance registers an Instance created by another Reasoner
-func (br *bikeReasoner) RegisterInstance(i bspl.Instance) error {
-	if _, found := br.openInstances[i.Key()]; found {
-		return fmt.Errorf("Instance '%s' already existed", i.Key())
-	}
-	// TODO: verify who sends the message and assert the role ID is correct.
-	// This should be done in the library, not the demo.
-	if len(i.Roles()) < 2 {
-		return fmt.Errorf("Missing roles for instance '%s'", i.Key())
-	}
-	found := false
-	for _, proto := range br.offeredServices {
-		if proto.Key() == i.Protocol().Key() {
-			found = true
-		}
-	}
-	if !found {
-		return fmt.Errorf("Protocol '%s' not offered", i.Protocol().Key())
-	}
-	br.openInstances[i.Key()] = i
-
-	var err error
-	switch i.Protocol().Key() {
-	case bikeRideProtocol.Key():
-		err = br.registerBikeRide(i)
-	}
-	if err != nil {
-		logger.Errorf("[%s] %s", shortID(br.Node.ID()), err)
-	}
-	return err
+	return b
 }
 
 // UpdateInstance updates an instance with a newer version of itself
 // as long as a valid run from one to the other.
 func (br *bikeReasoner) UpdateInstance(j bspl.Instance) error {
-	i, found := br.openInstances[j.Key()]
-	if !found {
+	br.mutex.Lock()
+	if _, found := br.GetInstance(j.Key()); !found {
 		// buffer bike drops that in specific cases may arrive before the pickups
 		if j.Protocol().Key() == bikeRideProtocol.Key() {
 			br.updateBuffer[j.Key()] = j
 		}
+		br.mutex.Unlock()
 		return fmt.Errorf("Instance '%s' not found", j.Key())
 	}
-	actions, _, err := i.Diff(j)
-	if err != nil {
-		return err
-	}
-	switch j.Protocol().Key() {
-	case bikeRideProtocol.Key():
-		err = br.updateBikeRide(j, actions)
-	}
-	if err != nil {
-		return err
-	}
-	i.Update(j)
-	return nil
+	br.mutex.Unlock()
+	return br.baseReasoner.UpdateInstance(j)
 }
 
 func (br *bikeReasoner) updateBikeRide(j bspl.Instance, actions []bspl.Action) error {
@@ -155,35 +92,95 @@ func (br *bikeReasoner) updateBikeRide(j bspl.Instance, actions []bspl.Action) e
 		return errors.New("Unexpected actions")
 	}
 	stationID := j.GetValue("dropStation")
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
 	logger.Debugf("\t[%s] Dropped at %s by %s",
 		shortID(br.Node.ID()), shortID(stationID), shortID(br.currentRider))
 
-	br.currentStation = stationID
 	br.currentRider = peer.ID("")
+	br.complete(j.Key())
+	if stationID != "" {
+		go func() {
+			if err := br.dock(stationID); err != nil {
+				logger.Errorf("[%s] %s", shortID(br.Node.ID()), err)
+			}
+		}()
+	}
 	return nil
 }
 
-func (br *bikeReasoner) registerBikeRide(i bspl.Instance) error {
-	var rider string
-	for role, actor := range i.Roles() {
-		if role == "Rider" {
-			rider = actor
+func (br *bikeReasoner) instantiateBikeStorage(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
+	i := imp.NewInstance(bikeStorageProtocol, roles)
+	i.SetValue("ID", uuid.New().String())
+	return i, nil
+}
+
+func (br *bikeReasoner) updateBikeStorage(j bspl.Instance, actions []bspl.Action) error {
+	if len(actions) != 1 || actions[0].Name != "release" {
+		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
+	}
+	stationID := j.Roles()["Station"]
+	br.mutex.Lock()
+	// the bike may have been picked up before the release arrived
+	if br.currentStation == stationID {
+		br.currentStation = ""
+	}
+	br.mutex.Unlock()
+	logger.Debugf("\t[%s] Released from %s for rental %s",
+		shortID(br.Node.ID()), shortID(stationID), j.GetValue("rentalID"))
+	br.complete(j.Key())
+	return nil
+}
+
+func (br *bikeReasoner) dock(stationID string) error {
+	station, err := peer.IDB58Decode(stationID)
+	if err != nil {
+		return fmt.Errorf("Invalid station ID: '%s'", stationID)
+	}
+	// wait until the station node is found
+	found := make(chan bool)
+	defer close(found)
+	go waitForContact(br.Node, stationID, found)
+	_ = <-found
+	roles := bspl.Roles{"Bike": br.Node.ID().Pretty(), "Station": stationID}
+	i, err := br.Instantiate(bikeStorageProtocol, roles, bspl.Values{})
+	if err != nil {
+		return err
+	}
+	br.Node.SetInstancePeer(i.Key(), station)
+	ok, err := br.Node.SendEvent(station, events.MakeNewEvent(i))
+	if err != nil || !ok {
+		br.DropInstance(i.Key(), "Dock rejected")
+		if err == nil {
+			err = fmt.Errorf("Station '%s' rejected the bike", stationID)
 		}
+		return err
 	}
-	riderID, err := peer.IDB58Decode(rider)
+	br.mutex.Lock()
+	br.currentStation = stationID
+	br.mutex.Unlock()
+	logger.Debugf("\t[%s] Docked at %s", shortID(br.Node.ID()), shortID(stationID))
+	return nil
+}
+
+func (br *bikeReasoner) registerBikeRide(i bspl.Instance) error {
+	riderID, err := typed(i).RolePeer("Rider")
 	if err != nil {
-		motive := fmt.Sprintf("Invalid or null Rider '%s'", riderID)
-		go sendEvent(events.MakeDropEvent(i.Key(), motive), i, br.Node)
-		br.DropInstance(i.Key(), motive)
+		return br.reject(i, err)
 	}
+	br.mutex.Lock()
 	br.currentRider = riderID
 	br.currentStation = ""
+	update, buffered := br.updateBuffer[i.Key()]
+	delete(br.updateBuffer, i.Key())
+	br.mutex.Unlock()
 
 	logger.Infof("\t[%s] New rider %s", shortID(br.Node.ID()), shortID(riderID))
 
-	if update, found := br.updateBuffer[i.Key()]; found {
-		err = br.UpdateInstance(update)
-		delete(br.updateBuffer, i.Key())
+	if buffered {
+		if err := br.UpdateInstance(update); err != nil {
+			logger.Errorf("[%s] %s", shortID(br.Node.ID()), err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package v2
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the agents, so that they can run on
+// simulated time
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// WallClock is the real time clock
+type WallClock struct{}
+
+// Now returns the current time
+func (WallClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current
+// time on the returned channel
+func (WallClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Sleep pauses the current goroutine for at least the duration d
+func (WallClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// VirtualClock only moves forward when it is advanced. It is safe
+// for concurrent use.
+type VirtualClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []virtualTimer
+}
+
+type virtualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewVirtualClock is the default constructor for VirtualClock
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start, timers: make([]virtualTimer, 0)}
+}
+
+// Now returns the current virtual time
+func (vc *VirtualClock) Now() time.Time {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	return vc.now
+}
+
+// After sends the virtual time on the returned channel once the
+// clock has been advanced by at least the duration d
+func (vc *VirtualClock) After(d time.Duration) <-chan time.Time {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- vc.now
+		return c
+	}
+	vc.timers = append(vc.timers, virtualTimer{at: vc.now.Add(d), c: c})
+	return c
+}
+
+// Sleep pauses the current goroutine until the clock has been
+// advanced by at least the duration d
+func (vc *VirtualClock) Sleep(d time.Duration) {
+	<-vc.After(d)
+}
+
+// Advance the clock, firing the timers that expire meanwhile in the
+// order they expire, each with the time it expired at
+func (vc *VirtualClock) Advance(d time.Duration) {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	vc.now = vc.now.Add(d)
+	pending := make([]virtualTimer, 0, len(vc.timers))
+	expired := make([]virtualTimer, 0)
+	for _, t := range vc.timers {
+		if t.at.After(vc.now) {
+			pending = append(pending, t)
+		} else {
+			expired = append(expired, t)
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].at.Before(expired[j].at)
+	})
+	for _, t := range expired {
+		t.c <- t.at
+	}
+	vc.timers = pending
+}
+
+// nextTimer returns when the earliest pending timer expires, false if
+// there are none
+func (vc *VirtualClock) nextTimer() (time.Time, bool) {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	var next time.Time
+	for _, t := range vc.timers {
+		if next.IsZero() || t.at.Before(next) {
+			next = t.at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Drive advances the clock speedup times faster than the real time
+// until the returned function is called
+func (vc *VirtualClock) Drive(speedup float64) func() {
+	tick := 10 * time.Millisecond
+	ticker := time.NewTicker(tick)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				vc.Advance(time.Duration(float64(tick) * speedup))
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
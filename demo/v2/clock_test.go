@@ -0,0 +1,75 @@
+package v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Date(2020, 6, 18, 8, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	early := clock.After(time.Minute)
+	late := clock.After(time.Hour)
+	if now := <-clock.After(0); !now.Equal(start) {
+		t.Errorf("Expected %v, got %v", start, now)
+	}
+
+	clock.Advance(30 * time.Minute)
+	select {
+	case now := <-early:
+		if want := start.Add(time.Minute); !now.Equal(want) {
+			t.Errorf("Expected %v, got %v", want, now)
+		}
+	default:
+		t.Error("Timer didn't fire")
+	}
+	select {
+	case <-late:
+		t.Error("Timer fired early")
+	default:
+	}
+
+	clock.Advance(30 * time.Minute)
+	select {
+	case <-late:
+	default:
+		t.Error("Timer didn't fire")
+	}
+	if now := clock.Now(); !now.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected %v, got %v", start.Add(time.Hour), now)
+	}
+}
+
+func TestVirtualClock_Advance(t *testing.T) {
+	start := time.Date(2020, 6, 18, 8, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+	late := clock.After(time.Hour)
+	early := clock.After(time.Minute)
+
+	if next, found := clock.nextTimer(); !found || !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the next timer at %v, got %v", start.Add(time.Minute), next)
+	}
+	// timers passed by a single advance fire at the time they expired
+	clock.Advance(2 * time.Hour)
+	if now, want := <-early, start.Add(time.Minute); !now.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, now)
+	}
+	if now, want := <-late, start.Add(time.Hour); !now.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, now)
+	}
+	if _, found := clock.nextTimer(); found {
+		t.Error("Fired timer still pending")
+	}
+}
+
+func TestVirtualClock_Drive(t *testing.T) {
+	clock := NewVirtualClock(time.Now())
+	stop := clock.Drive(3600)
+	defer stop()
+	select {
+	case <-clock.After(time.Hour):
+	case <-time.After(5 * time.Second):
+		t.Error("Driven clock didn't advance")
+	}
+}
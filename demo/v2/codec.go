@@ -0,0 +1,177 @@
+package v2
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/mikelsr/bspl"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// decoders of the values of each parameter type
+var decoders = map[demo.ParamType]func(string) (interface{}, error){
+	demo.StringParam: func(s string) (interface{}, error) { return s, nil },
+	demo.IntParam:    func(s string) (interface{}, error) { return strconv.Atoi(s) },
+	demo.FloatParam:  func(s string) (interface{}, error) { return strconv.ParseFloat(s, 64) },
+	demo.TimeParam:   func(s string) (interface{}, error) { return time.Parse(time.RFC3339, s) },
+	demo.CoordsParam: func(s string) (interface{}, error) { return parseCoords(s) },
+	demo.PeerParam:   func(s string) (interface{}, error) { return peer.IDB58Decode(s) },
+}
+
+// schemas of the protocols by key, see UseProtocols
+var schemas = map[string]demo.Schema{
+	bikeNegotiationProtocol.Key():  demo.GetSchema(bikeNegotiationFile),
+	bikeRentalProtocol.Key():       demo.GetSchema(bikeRentalFile),
+	bikeRequestProtocol.Key():      demo.GetSchema(bikeRequestFile),
+	bikeRideProtocol.Key():         demo.GetSchema(bikeRideFile),
+	bikeStorageProtocol.Key():      demo.GetSchema(bikeStorageFile),
+	bikeTransportProtocol.Key():    demo.GetSchema(bikeTransportFile),
+	stationInventoryProtocol.Key(): demo.GetSchema(stationInventoryFile),
+	stationRegistryProtocol.Key():  demo.GetSchema(stationRegistryFile),
+	stationSearchProtocol.Key():    demo.GetSchema(stationSearchFile),
+}
+
+// checkValues decodes every value set of an instance as the type of
+// its parameter and checks it against the schema, returns the first
+// malformed one
+func checkValues(i bspl.Instance) error {
+	schema := schemas[i.Protocol().Key()]
+	params := make([]string, 0, len(schema))
+	for param := range schema {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		value := i.GetValue(param)
+		if value == "" {
+			continue
+		}
+		if _, err := decoders[schema[param].Type](value); err != nil {
+			return invalidValue(param, schema[param].Type, value)
+		}
+		if err := schema[param].Check(value); err != nil {
+			return fmt.Errorf("Invalid '%s': %s", param, err)
+		}
+	}
+	return nil
+}
+
+func invalidValue(param string, t demo.ParamType, value string) error {
+	return fmt.Errorf("Invalid %s '%s': '%s'", t, param, value)
+}
+
+// typedInstance reads and writes the values of an instance as the
+// types of their parameters
+type typedInstance struct {
+	bspl.Instance
+}
+
+// typed values of an instance
+func typed(i bspl.Instance) typedInstance {
+	return typedInstance{Instance: i}
+}
+
+// decode the value of a parameter of the given type
+func (t typedInstance) decode(param string, pt demo.ParamType) (interface{}, error) {
+	if schemas[t.Protocol().Key()][param].Type != pt {
+		return nil, fmt.Errorf("Parameter '%s' of %s isn't %s", param, t.Protocol().Name, pt)
+	}
+	value := t.GetValue(param)
+	if value == "" {
+		return nil, fmt.Errorf("Missing parameter '%s'", param)
+	}
+	v, err := decoders[pt](value)
+	if err != nil {
+		return nil, invalidValue(param, pt, value)
+	}
+	return v, nil
+}
+
+// Int value of a parameter
+func (t typedInstance) Int(param string) (int, error) {
+	v, err := t.decode(param, demo.IntParam)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int), nil
+}
+
+// SetInt value of a parameter
+func (t typedInstance) SetInt(param string, v int) {
+	t.SetValue(param, strconv.Itoa(v))
+}
+
+// Float value of a parameter
+func (t typedInstance) Float(param string) (float64, error) {
+	v, err := t.decode(param, demo.FloatParam)
+	if err != nil {
+		return 0, err
+	}
+	return v.(float64), nil
+}
+
+// SetFloat value of a parameter
+func (t typedInstance) SetFloat(param string, v float64) {
+	t.SetValue(param, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// Time value of a parameter
+func (t typedInstance) Time(param string) (time.Time, error) {
+	v, err := t.decode(param, demo.TimeParam)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return v.(time.Time), nil
+}
+
+// SetTime value of a parameter
+func (t typedInstance) SetTime(param string, v time.Time) {
+	t.SetValue(param, formatTime(v))
+}
+
+// Coords value of a parameter
+func (t typedInstance) Coords(param string) (Coords, error) {
+	v, err := t.decode(param, demo.CoordsParam)
+	if err != nil {
+		return Coords{}, err
+	}
+	return v.(Coords), nil
+}
+
+// SetCoords value of a parameter
+func (t typedInstance) SetCoords(param string, v Coords) {
+	t.SetValue(param, v.String())
+}
+
+// Peer value of a parameter
+func (t typedInstance) Peer(param string) (peer.ID, error) {
+	v, err := t.decode(param, demo.PeerParam)
+	if err != nil {
+		return "", err
+	}
+	return v.(peer.ID), nil
+}
+
+// SetPeer value of a parameter
+func (t typedInstance) SetPeer(param string, v peer.ID) {
+	t.SetValue(param, v.Pretty())
+}
+
+// RolePeer is the peer playing a role of the instance
+func (t typedInstance) RolePeer(role string) (peer.ID, error) {
+	actor := t.Roles()[bspl.Role(role)]
+	id, err := peer.IDB58Decode(actor)
+	if err != nil {
+		return "", fmt.Errorf("Invalid or null %s '%s'", role, actor)
+	}
+	return id, nil
+}
+
+// formatTime as the values of the time parameters
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
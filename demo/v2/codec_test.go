@@ -0,0 +1,127 @@
+package v2
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+	"github.com/mikelsr/nahs-demo/protocols"
+)
+
+func TestTypedInstance(t *testing.T) {
+	i := typed(imp.NewInstance(bikeTransportProtocol, bspl.Roles{}))
+	dt := time.Date(2020, 6, 18, 8, 0, 0, 500, time.UTC)
+	i.SetInt("bikeNum", 3)
+	i.SetTime("datetime", dt)
+	if n, err := i.Int("bikeNum"); err != nil || n != 3 {
+		t.Errorf("Expected 3 bikes, got %d (%v)", n, err)
+	}
+	if parsed, err := i.Time("datetime"); err != nil || !parsed.Equal(dt) {
+		t.Errorf("Expected %v, got %v (%v)", dt, parsed, err)
+	}
+	if err := checkValues(i); err != nil {
+		t.Error(err)
+	}
+	// missing, of another type or malformed
+	if _, err := i.Int("movedNum"); err == nil {
+		t.Error("Missing value decoded")
+	}
+	if _, err := i.Float("bikeNum"); err == nil {
+		t.Error("Value decoded as another type")
+	}
+	i.SetValue("bikeNum", "two")
+	if _, err := i.Int("bikeNum"); err == nil {
+		t.Error("Malformed value decoded")
+	}
+	if err := checkValues(i); err == nil {
+		t.Error("Malformed value checked")
+	}
+	// out of range or not one of the values allowed
+	i.SetValue("bikeNum", "0")
+	if err := checkValues(i); err == nil {
+		t.Error("Value out of range checked")
+	}
+	i.SetValue("bikeNum", "1")
+	i.SetValue("result", "maybe")
+	if err := checkValues(i); err == nil {
+		t.Error("Value not in the enum checked")
+	}
+}
+
+func TestSchemas(t *testing.T) {
+	for key, schema := range schemas {
+		for param, s := range schema {
+			if _, found := decoders[s.Type]; !found {
+				t.Errorf("No decoder for parameter '%s' of %s of type %s", param, key, s.Type)
+			}
+		}
+	}
+}
+
+func TestReasoner_reject(t *testing.T) {
+	s := Scenario{
+		Stations: []StationSpec{{Name: "s", Coords: Coords{Lat: 0, Lon: 0}, Bikes: 1}},
+		Renters:  []RenterSpec{{Name: "r", Stations: []string{"s"}}},
+		People:   []PersonSpec{{Name: "p"}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, r := w.People["p"], w.Renters["r"]
+	roles := bspl.Roles{"Client": p.ID(), "Renter": r.ID()}
+
+	// malformed inputs aren't instantiated
+	inputs := bspl.Values{"in rentalID": "rental", "in round": "1", "in bid": "cheap"}
+	if _, err := p.reasoner.Instantiate(bikeNegotiationProtocol, roles, inputs); err == nil {
+		t.Error("Instantiated a malformed bid")
+	}
+	// and the instances with malformed values are dropped
+	i := imp.NewInstance(bikeNegotiationProtocol, roles)
+	i.SetValue("rentalID", "rental")
+	i.SetValue("round", "first")
+	i.SetValue("bid", "0.01")
+	if err := r.reasoner.RegisterInstance(i); err == nil {
+		t.Error("Registered a malformed round")
+	}
+	if dropped := r.reasoner.InstancesIn(bikeNegotiationProtocol, demo.InstanceDropped); len(dropped) != 1 {
+		t.Errorf("Expected the instance dropped, got %v", dropped)
+	}
+}
+
+func TestUseProtocols(t *testing.T) {
+	defer UseProtocols(demo.Protocols)
+	r, err := demo.NewRegistry(fstest.MapFS{
+		"bike_ride.bspl": &fstest.MapFile{Data: []byte(bikeRideProtocol.String())},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UseProtocols(r); err == nil {
+		t.Error("Used a registry without most of the protocols")
+	}
+	// the protocols stay as they were
+	if len(schemas[bikeRentalProtocol.Key()]) == 0 {
+		t.Error("Schemas replaced by an incomplete registry")
+	}
+
+	// replace the schema of BikeTransport
+	override := fstest.MapFS{
+		"bike_transport.schema.json": &fstest.MapFile{Data: []byte(`{"bikeNum": {"type": "int", "min": 5}}`)},
+	}
+	if r, err = demo.NewRegistry(protocols.FS, override); err != nil {
+		t.Fatal(err)
+	}
+	if err := UseProtocols(r); err != nil {
+		t.Fatal(err)
+	}
+	i := imp.NewInstance(bikeTransportProtocol, bspl.Roles{})
+	typed(i).SetInt("bikeNum", 3)
+	if err := checkValues(i); err == nil {
+		t.Error("Value checked with the embedded schema")
+	}
+}
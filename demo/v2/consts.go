@@ -1,35 +1,125 @@
 package v2
 
 import (
+	"fmt"
+	"os"
 	"time"
 
 	log "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p"
+	"github.com/mikelsr/bspl"
 
 	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 const (
-	bikeRentalFile    = "bike_rental.bspl"
-	bikeRequestFile   = "bike_request.bspl"
-	bikeRideFile      = "bike_ride.bspl"
-	bikeStorageFile   = "bike_storage.bspl"
-	bikeTransportFile = "bike_transport.bspl"
-	stationSearchFile = "station_search.bspl"
+	bikeNegotiationFile  = "bike_negotiation.bspl"
+	bikeRentalFile       = "bike_rental.bspl"
+	bikeRequestFile      = "bike_request.bspl"
+	bikeRideFile         = "bike_ride.bspl"
+	bikeStorageFile      = "bike_storage.bspl"
+	bikeTransportFile    = "bike_transport.bspl"
+	stationInventoryFile = "station_inventory.bspl"
+	stationRegistryFile  = "station_registry.bspl"
+	stationSearchFile    = "station_search.bspl"
 
 	logName = "nahs-demo/v2"
 )
 
 var (
-	bikeRequestProtocol   = demo.GetProtocol(bikeRequestFile)
-	bikeRentalProtocol    = demo.GetProtocol(bikeRentalFile)
-	bikeRideProtocol      = demo.GetProtocol(bikeRideFile)
-	bikeStorageProtocol   = demo.GetProtocol(bikeStorageFile)
-	bikeTransportProtocol = demo.GetProtocol(bikeTransportFile)
-	stationSearchProtocol = demo.GetProtocol(stationSearchFile)
+	bikeNegotiationProtocol  = demo.GetProtocol(bikeNegotiationFile)
+	bikeRequestProtocol      = demo.GetProtocol(bikeRequestFile)
+	bikeRentalProtocol       = demo.GetProtocol(bikeRentalFile)
+	bikeRideProtocol         = demo.GetProtocol(bikeRideFile)
+	bikeStorageProtocol      = demo.GetProtocol(bikeStorageFile)
+	bikeTransportProtocol    = demo.GetProtocol(bikeTransportFile)
+	stationInventoryProtocol = demo.GetProtocol(stationInventoryFile)
+	stationRegistryProtocol  = demo.GetProtocol(stationRegistryFile)
+	stationSearchProtocol    = demo.GetProtocol(stationSearchFile)
 
 	logger = log.Logger(logName)
 	// LocalNodes must be set to True if the used nodes are local nodes
 	LocalNodes = false
+	// NodeOptions are passed to the node of every agent created
+	// afterwards, e.g. to set its identity or listen addresses
+	NodeOptions []libp2p.Option
 
 	timeout = 2 * time.Second
+	// defaultReservationTTL is how long a bike is held for an offer
+	defaultReservationTTL = 5 * time.Minute
+	// reservationGrace is how long a station holds a reservation past
+	// its TTL, so that the reserver cancels it before it expires
+	reservationGrace = time.Minute
+	// deliveryGrace is how long past the time requested a university
+	// waits to be told whether the bikes arrived
+	deliveryGrace = time.Minute
 )
+
+// Protocol returns one of the protocols enacted by the agents
+// given its name, e.g. BikeRental
+func Protocol(name string) (bspl.Protocol, bool) {
+	for _, p := range []bspl.Protocol{
+		bikeNegotiationProtocol,
+		bikeRequestProtocol,
+		bikeRentalProtocol,
+		bikeRideProtocol,
+		bikeStorageProtocol,
+		bikeTransportProtocol,
+		stationInventoryProtocol,
+		stationRegistryProtocol,
+		stationSearchProtocol,
+	} {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return bspl.Protocol{}, false
+}
+
+// UseProtocols makes the agents created afterwards enact the protocols
+// of a registry, e.g. one built by demo.LoadProtocols, and check their
+// values with its schemas. The registry must have a protocol for every
+// protocol file of the agents.
+func UseProtocols(r *demo.Registry) error {
+	files := map[string]*bspl.Protocol{
+		bikeNegotiationFile:  &bikeNegotiationProtocol,
+		bikeRequestFile:      &bikeRequestProtocol,
+		bikeRentalFile:       &bikeRentalProtocol,
+		bikeRideFile:         &bikeRideProtocol,
+		bikeStorageFile:      &bikeStorageProtocol,
+		bikeTransportFile:    &bikeTransportProtocol,
+		stationInventoryFile: &stationInventoryProtocol,
+		stationRegistryFile:  &stationRegistryProtocol,
+		stationSearchFile:    &stationSearchProtocol,
+	}
+	loaded := make(map[string]bspl.Protocol, len(files))
+	loadedSchemas := make(map[string]demo.Schema, len(files))
+	for file := range files {
+		p, found := r.GetByFile(file)
+		if !found {
+			return fmt.Errorf("Protocol file '%s' not found", file)
+		}
+		loaded[file] = p
+		loadedSchemas[p.Key()], _ = r.Schema(p.Key())
+	}
+	for file, p := range files {
+		*p = loaded[file]
+	}
+	schemas = loadedSchemas
+	return nil
+}
+
+// LoadProtocolsFromEnv makes the agents created afterwards enact the
+// protocols of the directory set in demo.ProtocolsEnv, if any, over
+// the embedded ones
+func LoadProtocolsFromEnv() error {
+	dir := os.Getenv(demo.ProtocolsEnv)
+	if dir == "" {
+		return nil
+	}
+	r, err := demo.LoadProtocols(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %s", demo.ProtocolsEnv, err)
+	}
+	return UseProtocols(r)
+}
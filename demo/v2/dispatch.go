@@ -0,0 +1,265 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/nahs/events"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// transportJob is a number of bikes that must arrive at a station,
+// and the transports already asked to move them
+type transportJob struct {
+	bikeNum  int
+	dst      string
+	datetime time.Time
+	// sources are the stations the bikes may be taken from
+	sources []string
+	tried   []string
+	// delivered is the number of bikes already moved to the station
+	delivered int
+	// done is called once the job is over, with the reason some bikes
+	// weren't delivered if any
+	done func(job *transportJob, reason string)
+}
+
+// remaining is the number of bikes left to move
+func (job *transportJob) remaining() int {
+	return job.bikeNum - job.delivered
+}
+
+// asked returns whether a transport was already asked for the job
+func (job *transportJob) asked(transportID string) bool {
+	for _, t := range job.tried {
+		if t == transportID {
+			return true
+		}
+	}
+	return false
+}
+
+// transportClient requests bike transports through the BikeTransport
+// protocol and retries them with other transports if they fail
+type transportClient struct {
+	reasoner  *baseReasoner
+	inventory *inventoryClient
+
+	mutex    sync.Mutex
+	requests map[string]chan string
+	// jobs are the transports accepted and not yet over, by instance key
+	jobs map[string]*transportJob
+}
+
+// newTransportClient makes the reasoner consume the BikeTransport protocol
+func newTransportClient(reasoner *baseReasoner, inventory *inventoryClient) *transportClient {
+	tc := &transportClient{reasoner: reasoner, inventory: inventory}
+	tc.requests = make(map[string]chan string)
+	tc.jobs = make(map[string]*transportJob)
+	reasoner.consume(bikeTransportProtocol, tc.instantiateBikeTransport, tc.updateBikeTransport)
+	return tc
+}
+
+func (tc *transportClient) instantiateBikeTransport(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
+	params, err := requireValues(values, "in bikeNum", "in src", "in dst", "in datetime")
+	if err != nil {
+		return nil, err
+	}
+	i := imp.NewInstance(bikeTransportProtocol, roles)
+	i.SetValue("ID", uuid.New().String())
+	i.SetValue("dst", params["in dst"])
+	i.SetValue("src", params["in src"])
+	i.SetValue("datetime", params["in datetime"])
+	i.SetValue("bikeNum", params["in bikeNum"])
+	return i, nil
+}
+
+func (tc *transportClient) updateBikeTransport(j bspl.Instance, actions []bspl.Action) error {
+	node := tc.reasoner.Node
+	rID := j.GetValue("rID")
+	result := j.GetValue("result")
+	if rID == "" {
+		return errors.New("Empty rID")
+	}
+	if result == "" {
+		// accept/reject
+		tc.mutex.Lock()
+		requestResult, found := tc.requests[j.Key()]
+		delete(tc.requests, j.Key())
+		if found && rID != "accept" {
+			delete(tc.jobs, j.Key())
+		}
+		tc.mutex.Unlock()
+		if !found {
+			return fmt.Errorf("No pending transport for instance '%s'", j.Key())
+		}
+		if rID != "accept" {
+			tc.reasoner.complete(j.Key())
+		}
+		requestResult <- rID
+		return nil
+	}
+	// success or failure
+	moved, err := typed(j).Int("movedNum")
+	if err == nil && moved < 0 {
+		err = fmt.Errorf("Invalid movedNum: %d", moved)
+	}
+	if err != nil {
+		return tc.reasoner.reject(j, err)
+	}
+	tc.mutex.Lock()
+	job, found := tc.jobs[j.Key()]
+	delete(tc.jobs, j.Key())
+	if found {
+		job.delivered += moved
+	}
+	tc.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No accepted transport for instance '%s'", j.Key())
+	}
+	tc.reasoner.complete(j.Key())
+	switch result {
+	case "success":
+		logger.Infof("[%s] Transported %d bikes to %s", shortID(node.ID()),
+			moved, shortID(job.dst))
+		go job.done(job, "")
+	case "failure":
+		go tc.retry(job, j.GetValue("reason"))
+	default:
+		return fmt.Errorf("Invalid result: '%s'", result)
+	}
+	return nil
+}
+
+// retry asks the transports not asked yet for the bikes left to move
+// of a failed job while there's time left, the job is over otherwise
+func (tc *transportClient) retry(job *transportJob, reason string) {
+	node := tc.reasoner.Node
+	logger.Errorf("[%s] Transport of %d bikes to %s failed: %s", shortID(node.ID()),
+		job.remaining(), shortID(job.dst), reason)
+	if tc.reasoner.clock.Now().Before(job.datetime) {
+		err := tc.dispatch(job)
+		if err == nil {
+			return
+		}
+		logger.Errorf("[%s] Couldn't retry transport to %s: %s", shortID(node.ID()),
+			shortID(job.dst), err)
+	}
+	job.done(job, reason)
+}
+
+// dispatch asks the transports not asked yet for a job, one at a time,
+// until one of them accepts it
+func (tc *transportClient) dispatch(job *transportJob) error {
+	node := tc.reasoner.Node
+	transports := demo.FindContacts(node, bikeTransportProtocol.Key(), "Transport")
+	if len(transports) == 0 {
+		return errors.New("No transports found")
+	}
+	for _, id := range transports {
+		if job.asked(id.Pretty()) {
+			continue
+		}
+		job.tried = append(job.tried, id.Pretty())
+		// the stations are queried again for each transport, as a
+		// failed one may have left fewer bikes than expected
+		src, err := tc.source(job)
+		if err != nil {
+			return err
+		}
+		if err := tc.request(job, src, id); err != nil {
+			logger.Errorf("[%s] %s", shortID(node.ID()), err)
+			continue
+		}
+		return nil
+	}
+	return errors.New("No transport accepted the job")
+}
+
+// source is the station of a job with the most available bikes other
+// than its destination
+func (tc *transportClient) source(job *transportJob) (string, error) {
+	var src string
+	m := 0
+	for _, s := range job.sources {
+		if s == job.dst {
+			continue
+		}
+		report, err := tc.inventory.query(s)
+		if err != nil {
+			logger.Errorf("[%s] %s", shortID(tc.reasoner.Node.ID()), err)
+			continue
+		}
+		if report.available > m {
+			src = s
+			m = report.available
+		}
+	}
+	if src == "" || m < job.remaining() {
+		return "", errors.New("Couldn't find a station to take bikes from")
+	}
+	return src, nil
+}
+
+// request the transport of the bikes of a job from a station
+func (tc *transportClient) request(job *transportJob, src string, id peer.ID) error {
+	node := tc.reasoner.Node
+	logger.Debugf("[%s] Request bike transport from %s", shortID(node.ID()), shortID(id))
+	roles := bspl.Roles{"Requester": node.ID().Pretty(), "Transport": id.Pretty()}
+	inputs := bspl.Values{
+		"in src":      src,
+		"in dst":      job.dst,
+		"in bikeNum":  strconv.Itoa(job.remaining()),
+		"in datetime": formatTime(job.datetime),
+	}
+	instance, err := tc.reasoner.Instantiate(bikeTransportProtocol, roles, inputs)
+	if err != nil {
+		return err
+	}
+	key := instance.Key()
+	node.SetInstancePeer(key, id)
+	// the answer may arrive before the event is acknowledged
+	result := make(chan string, 1)
+	tc.mutex.Lock()
+	tc.requests[key] = result
+	tc.jobs[key] = job
+	tc.mutex.Unlock()
+	ok, err := node.SendEvent(id, events.MakeNewEvent(instance))
+	if err != nil || !ok {
+		tc.forget(key, "Transport request not delivered")
+		if err == nil {
+			err = fmt.Errorf("Transport '%s' rejected the request", id)
+		}
+		return err
+	}
+	select {
+	case rID := <-result:
+		if rID != "accept" {
+			return fmt.Errorf("Transport '%s' rejected the request", id)
+		}
+	// network round trips are measured in real time whatever the clock
+	case <-time.After(timeout):
+		tc.forget(key, "Transport request timed out")
+		return fmt.Errorf("Transport '%s' didn't answer", id)
+	}
+	return nil
+}
+
+// forget a transport request that won't be carried out
+func (tc *transportClient) forget(key, motive string) {
+	tc.mutex.Lock()
+	delete(tc.requests, key)
+	delete(tc.jobs, key)
+	tc.mutex.Unlock()
+	if _, open := tc.reasoner.GetInstance(key); open {
+		tc.reasoner.DropInstance(key, motive)
+	}
+}
@@ -0,0 +1,401 @@
+package v2
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+)
+
+// metrics of a distance spec
+const (
+	metricHaversine = "haversine"
+	metricEuclidean = "euclidean"
+	metricManhattan = "manhattan"
+	metricNetwork   = "network"
+)
+
+// earthRadius is the mean radius of the Earth in meters
+const earthRadius = 6371008.8
+
+// DistanceProvider measures the distance in meters between two points,
+// e.g. to find the nearest stations, price rentals or plan transports.
+// The distance is infinite if there's no way from one point to the
+// other.
+type DistanceProvider interface {
+	Distance(a, b Coords) float64
+}
+
+// reachable is whether a measured distance leads anywhere
+func reachable(d float64) bool {
+	return d >= 0 && !math.IsInf(d, 1)
+}
+
+// Haversine distance along the surface of the Earth, as the crow flies
+type Haversine struct{}
+
+// Distance between two points
+func (Haversine) Distance(a, b Coords) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(radians(b.Lon-a.Lon)/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Euclidean distance on a plane tangent to the Earth halfway between
+// the points, close to the haversine one within a city
+type Euclidean struct{}
+
+// Distance between two points
+func (Euclidean) Distance(a, b Coords) float64 {
+	north, east := offsets(a, b)
+	return math.Hypot(north, east)
+}
+
+// Manhattan distance along a grid of north-south and east-west streets
+type Manhattan struct{}
+
+// Distance between two points
+func (Manhattan) Distance(a, b Coords) float64 {
+	north, east := offsets(a, b)
+	return math.Abs(north) + math.Abs(east)
+}
+
+// offsets in meters from a to b towards the north and the east, on a
+// plane tangent to the Earth halfway between them
+func offsets(a, b Coords) (north, east float64) {
+	north = radians(b.Lat-a.Lat) * earthRadius
+	east = radians(b.Lon-a.Lon) * earthRadius * math.Cos(radians((a.Lat+b.Lat)/2))
+	return north, east
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// StreetNetwork measures distances along the streets of a graph. Points
+// off the network are joined to their nearest node in a straight line.
+// It is safe for concurrent use.
+type StreetNetwork struct {
+	nodes []Coords
+	// edges leaving each node
+	edges [][]streetEdge
+	// index of the nodes by their rounded coordinates
+	index map[nodeKey]int
+	// grid of the nodes in each cell and the cells with some node
+	grid    map[gridCell][]int
+	minCell gridCell
+	maxCell gridCell
+
+	mutex sync.Mutex
+	// paths are the shortest distances from the nodes already searched
+	// to every other node
+	paths map[int][]float64
+}
+
+// streetEdge is a street between two nodes and its length
+type streetEdge struct {
+	to     int
+	length float64
+}
+
+// nodePrecision rounds the coordinates of the nodes, the points of the
+// streets closer than about a centimeter are the same node
+const nodePrecision = 1e7
+
+// nodeKey are the rounded coordinates of a node
+type nodeKey struct {
+	lat, lon int64
+}
+
+func keyOf(c Coords) nodeKey {
+	return nodeKey{lat: int64(math.Round(c.Lat * nodePrecision)), lon: int64(math.Round(c.Lon * nodePrecision))}
+}
+
+// gridSize is the side in degrees of the cells the nodes are grouped
+// in to find the nearest one, about a hundred meters
+const gridSize = 0.001
+
+// gridCell is a cell of the grid by its row and column
+type gridCell struct {
+	lat, lon int64
+}
+
+func cellOf(c Coords) gridCell {
+	return gridCell{lat: int64(math.Floor(c.Lat / gridSize)), lon: int64(math.Floor(c.Lon / gridSize))}
+}
+
+// NewStreetNetwork builds an empty street network
+func NewStreetNetwork() *StreetNetwork {
+	return &StreetNetwork{
+		index: make(map[nodeKey]int),
+		grid:  make(map[gridCell][]int),
+		paths: make(map[int][]float64),
+	}
+}
+
+// node returns the index of the node at the given coordinates, adding
+// it if new
+func (n *StreetNetwork) node(c Coords) int {
+	key := keyOf(c)
+	if i, found := n.index[key]; found {
+		return i
+	}
+	i := len(n.nodes)
+	n.nodes = append(n.nodes, c)
+	n.edges = append(n.edges, nil)
+	n.index[key] = i
+	cell := cellOf(c)
+	if len(n.grid) == 0 {
+		n.minCell, n.maxCell = cell, cell
+	}
+	n.grid[cell] = append(n.grid[cell], i)
+	n.minCell = gridCell{lat: min64(n.minCell.lat, cell.lat), lon: min64(n.minCell.lon, cell.lon)}
+	n.maxCell = gridCell{lat: max64(n.maxCell.lat, cell.lat), lon: max64(n.maxCell.lon, cell.lon)}
+	return i
+}
+
+// AddStreet joins a sequence of points, both ways unless oneway
+func (n *StreetNetwork) AddStreet(points []Coords, oneway bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.paths = make(map[int][]float64)
+	for k := 1; k < len(points); k++ {
+		from, to := n.node(points[k-1]), n.node(points[k])
+		length := Haversine{}.Distance(points[k-1], points[k])
+		n.edges[from] = append(n.edges[from], streetEdge{to: to, length: length})
+		if !oneway {
+			n.edges[to] = append(n.edges[to], streetEdge{to: from, length: length})
+		}
+	}
+}
+
+// nearest node to c, -1 if the network is empty. The cells of the grid
+// are searched in rings around the one of c, from the first ring with
+// nodes until the next ones are farther than the nearest node found.
+func (n *StreetNetwork) nearest(c Coords) int {
+	if len(n.nodes) == 0 {
+		return -1
+	}
+	center := cellOf(c)
+	// a ring is at least as far from c as its number of cells minus
+	// one, the width of a cell is narrower than its height
+	width := Haversine{}.Distance(c, Coords{Lat: c.Lat, Lon: c.Lon + gridSize})
+	first := max64(0, max64(max64(n.minCell.lat-center.lat, center.lat-n.maxCell.lat),
+		max64(n.minCell.lon-center.lon, center.lon-n.maxCell.lon)))
+	nearest, min := -1, math.Inf(1)
+	search := func(cell gridCell) {
+		for _, i := range n.grid[cell] {
+			if d := (Haversine{}).Distance(c, n.nodes[i]); d < min {
+				nearest, min = i, d
+			}
+		}
+	}
+	for r := first; ; r++ {
+		if nearest != -1 && float64(r-1)*width > min {
+			break
+		}
+		for lat := max64(center.lat-r, n.minCell.lat); lat <= min64(center.lat+r, n.maxCell.lat); lat++ {
+			// the whole row on the edges of the ring, its ends otherwise
+			if lat == center.lat-r || lat == center.lat+r {
+				for lon := max64(center.lon-r, n.minCell.lon); lon <= min64(center.lon+r, n.maxCell.lon); lon++ {
+					search(gridCell{lat: lat, lon: lon})
+				}
+				continue
+			}
+			search(gridCell{lat: lat, lon: center.lon - r})
+			search(gridCell{lat: lat, lon: center.lon + r})
+		}
+		// every cell with nodes searched
+		if center.lat-r <= n.minCell.lat && center.lat+r >= n.maxCell.lat &&
+			center.lon-r <= n.minCell.lon && center.lon+r >= n.maxCell.lon {
+			break
+		}
+	}
+	return nearest
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Distance between two points along the streets, infinite if no
+// street leads from one to the other
+func (n *StreetNetwork) Distance(a, b Coords) float64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	from, to := n.nearest(a), n.nearest(b)
+	if from == -1 {
+		return Haversine{}.Distance(a, b)
+	}
+	paths, found := n.paths[from]
+	if !found {
+		paths = n.shortestPaths(from)
+		n.paths[from] = paths
+	}
+	return Haversine{}.Distance(a, n.nodes[from]) + paths[to] + Haversine{}.Distance(n.nodes[to], b)
+}
+
+// shortestPaths from a node to every other one with Dijkstra's algorithm
+func (n *StreetNetwork) shortestPaths(from int) []float64 {
+	paths := make([]float64, len(n.nodes))
+	for i := range paths {
+		paths[i] = math.Inf(1)
+	}
+	paths[from] = 0
+	queue := &nodeQueue{{node: from}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(queuedNode)
+		if current.distance > paths[current.node] {
+			continue
+		}
+		for _, e := range n.edges[current.node] {
+			if d := current.distance + e.length; d < paths[e.to] {
+				paths[e.to] = d
+				heap.Push(queue, queuedNode{node: e.to, distance: d})
+			}
+		}
+	}
+	return paths
+}
+
+// queuedNode is a node reached at some distance
+type queuedNode struct {
+	node     int
+	distance float64
+}
+
+// nodeQueue is a priority queue of nodes, nearest first
+type nodeQueue []queuedNode
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queuedNode)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// geoJSON is the part of a GeoJSON feature collection read as streets
+type geoJSON struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"features"`
+}
+
+// LoadStreetNetwork reads the LineString and MultiLineString features
+// of a GeoJSON feature collection as streets, the first coordinate of
+// each position as the longitude and the second as the latitude, as
+// in GeoJSON. Features with a "oneway"
+// property set to true or "yes" are followed only in their direction.
+// OSM extracts can be converted to GeoJSON with tools like osmtogeojson.
+func LoadStreetNetwork(path string) (*StreetNetwork, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	collection := geoJSON{}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("Invalid GeoJSON '%s': %s", path, err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("Invalid GeoJSON '%s': not a FeatureCollection", path)
+	}
+	n := NewStreetNetwork()
+	for _, f := range collection.Features {
+		var lines [][][]float64
+		switch f.Geometry.Type {
+		case "LineString":
+			var line [][]float64
+			err = json.Unmarshal(f.Geometry.Coordinates, &line)
+			lines = [][][]float64{line}
+		case "MultiLineString":
+			err = json.Unmarshal(f.Geometry.Coordinates, &lines)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid GeoJSON '%s': %s", path, err)
+		}
+		oneway := f.Properties["oneway"] == true || f.Properties["oneway"] == "yes"
+		for _, line := range lines {
+			points := make([]Coords, len(line))
+			for i, position := range line {
+				if len(position) < 2 {
+					return nil, fmt.Errorf("Invalid GeoJSON '%s': position with %d coordinates", path, len(position))
+				}
+				points[i] = Coords{Lat: position[1], Lon: position[0]}
+				if err := points[i].Validate(); err != nil {
+					return nil, fmt.Errorf("Invalid GeoJSON '%s': %s", path, err)
+				}
+			}
+			n.AddStreet(points, oneway)
+		}
+	}
+	if len(n.nodes) == 0 {
+		return nil, fmt.Errorf("No streets found in '%s'", path)
+	}
+	return n, nil
+}
+
+// DistanceSpec configures how distances are measured
+type DistanceSpec struct {
+	// Metric is "haversine", the default, "euclidean", "manhattan" or
+	// "network"
+	Metric string `json:"metric"`
+	// Network is the GeoJSON file with the streets of the "network"
+	// metric
+	Network string `json:"network"`
+}
+
+// Validate the spec without loading the street network
+func (s DistanceSpec) Validate() error {
+	switch s.Metric {
+	case "", metricHaversine, metricEuclidean, metricManhattan:
+		return nil
+	case metricNetwork:
+		if s.Network == "" {
+			return errors.New("Missing street network file")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown distance metric '%s'", s.Metric)
+}
+
+// NewProvider builds the distance provider described by the spec,
+// loading its street network if any
+func (s DistanceSpec) NewProvider() (DistanceProvider, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	switch s.Metric {
+	case metricEuclidean:
+		return Euclidean{}, nil
+	case metricManhattan:
+		return Manhattan{}, nil
+	case metricNetwork:
+		return LoadStreetNetwork(s.Network)
+	}
+	return Haversine{}, nil
+}
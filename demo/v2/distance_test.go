@@ -0,0 +1,127 @@
+package v2
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const streetsScenario = "../../scenarios/streets.json"
+
+func TestDistanceProviders(t *testing.T) {
+	// a degree of latitude, a degree of longitude at the equator
+	degree := earthRadius * math.Pi / 180
+	tests := []struct {
+		name     string
+		d        DistanceProvider
+		a, b     Coords
+		expected float64
+	}{
+		{"haversine", Haversine{}, Coords{Lat: 0, Lon: 0}, Coords{Lat: 1, Lon: 0}, degree},
+		{"haversine", Haversine{}, Coords{Lat: 0, Lon: 179}, Coords{Lat: 0, Lon: -179}, 2 * degree},
+		{"haversine", Haversine{}, Coords{Lat: 60, Lon: 0}, Coords{Lat: 60, Lon: 0.001}, 0.001 * degree / 2},
+		{"euclidean", Euclidean{}, Coords{Lat: 0, Lon: 0}, Coords{Lat: 0.003, Lon: 0.004}, 0.005 * degree},
+		{"manhattan", Manhattan{}, Coords{Lat: 0, Lon: 0}, Coords{Lat: 0.003, Lon: -0.004}, 0.007 * degree},
+	}
+	for _, test := range tests {
+		// within a millimeter
+		if d := test.d.Distance(test.a, test.b); math.Abs(d-test.expected) > 1e-3 {
+			t.Errorf("%s from %s to %s: expected %f, got %f", test.name, test.a, test.b, test.expected, d)
+		}
+	}
+}
+
+func TestStreetNetwork_Distance(t *testing.T) {
+	s, err := LoadScenario(streetsScenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.Distance.NewProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Haversine{}.Distance
+	// the corners of the streets
+	southWest, south, southEast, east := Coords{Lat: 43.2601, Lon: -2.935}, Coords{Lat: 43.2601, Lon: -2.9349},
+		Coords{Lat: 43.2601, Lon: -2.9347}, Coords{Lat: 43.2601, Lon: -2.9346}
+	northWest, north, northEast, bridge := Coords{Lat: 43.2602, Lon: -2.935}, Coords{Lat: 43.2602, Lon: -2.9349},
+		Coords{Lat: 43.2602, Lon: -2.9347}, Coords{Lat: 43.2602, Lon: -2.9346}
+	offSouth, offSouthEast := Coords{Lat: 43.26011, Lon: -2.9349}, Coords{Lat: 43.26012, Lon: -2.9347}
+
+	tests := []struct {
+		a, b     Coords
+		expected float64
+	}{
+		// along a street
+		{south, southEast, h(south, southEast)},
+		// across the river, over the bridge
+		{south, north, h(south, southEast) + h(southEast, east) + h(east, bridge) + h(bridge, northEast) + h(northEast, north)},
+		// off the streets
+		{offSouth, offSouthEast, h(offSouth, south) + h(south, southEast) + h(southEast, offSouthEast)},
+		// the ferry only goes south
+		{north, south, h(north, northWest) + h(northWest, southWest) + h(southWest, south)},
+	}
+	for _, test := range tests {
+		if distance := d.Distance(test.a, test.b); math.Abs(distance-test.expected) > 1e-6 {
+			t.Errorf("From %s to %s: expected %f, got %f", test.a, test.b, test.expected, distance)
+		}
+	}
+
+	n := NewStreetNetwork()
+	n.AddStreet([]Coords{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 0.001}}, true)
+	n.AddStreet([]Coords{{Lat: 0, Lon: 0.002}, {Lat: 0, Lon: 0.003}}, false)
+	if d := n.Distance(Coords{Lat: 0, Lon: 0.001}, Coords{Lat: 0, Lon: 0}); !math.IsInf(d, 1) {
+		t.Errorf("Expected no way against a oneway street, got %f", d)
+	}
+	if d := n.Distance(Coords{Lat: 0, Lon: 0}, Coords{Lat: 0, Lon: 0.003}); !math.IsInf(d, 1) {
+		t.Errorf("Expected no way between unconnected streets, got %f", d)
+	}
+}
+
+func TestStreetNetwork_nearest(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	point := func(spread float64) Coords {
+		return Coords{Lat: 43.26 + (random.Float64()-0.5)*spread, Lon: -2.935 + (random.Float64()-0.5)*spread}
+	}
+	n := NewStreetNetwork()
+	for k := 0; k < 200; k++ {
+		n.AddStreet([]Coords{point(0.02), point(0.02)}, false)
+	}
+	// the same point rounded is the same node
+	c := n.nodes[0]
+	if i := n.node(Coords{Lat: c.Lat + 1e-9, Lon: c.Lon}); i != 0 || len(n.nodes) != 400 {
+		t.Errorf("Expected node 0 of 400, got %d of %d", i, len(n.nodes))
+	}
+	// the grid finds the same nodes as comparing every one, inside
+	// and far away from the network
+	for k := 0; k < 200; k++ {
+		c := point(0.05)
+		if k%10 == 0 {
+			c = point(2)
+		}
+		expected, min := -1, math.Inf(1)
+		for i, node := range n.nodes {
+			if d := (Haversine{}).Distance(c, node); d < min {
+				expected, min = i, d
+			}
+		}
+		if i := n.nearest(c); i != expected {
+			t.Errorf("Nearest node to %s: expected %d, got %d", c, expected, i)
+		}
+	}
+}
+
+func TestDistanceSpec_Validate(t *testing.T) {
+	invalid := []DistanceSpec{
+		{Metric: "teleport"},
+		{Metric: "network"},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Invalid spec accepted: %+v", s)
+		}
+	}
+	if _, err := (DistanceSpec{Metric: "network", Network: "missing.geojson"}).NewProvider(); err == nil {
+		t.Error("Missing street network loaded")
+	}
+}
@@ -0,0 +1,191 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/nahs/events"
+)
+
+// operations of the StationInventory protocol
+const (
+	inventoryQuery   = "query"
+	inventoryReserve = "reserve"
+	inventoryCancel  = "cancel"
+	inventoryRelease = "release"
+
+	// values can't be left empty, so operations without
+	// argument use a placeholder
+	noArgument = "none"
+	// result of the operations that succeeded
+	inventoryOK = "ok"
+)
+
+// inventoryReport is the answer of a station to an inventory request
+type inventoryReport struct {
+	bikeID    string
+	available int
+	coords    Coords
+	// docks is the number of free docks, unlimitedDocks if the station
+	// has no limit
+	docks int
+}
+
+// canDock returns whether a number of bikes can dock at the station
+func (r inventoryReport) canDock(bikes int) bool {
+	return r.docks == unlimitedDocks || r.docks >= bikes
+}
+
+// inventoryClient queries and changes the inventory of the stations
+// through the StationInventory protocol
+type inventoryClient struct {
+	reasoner *baseReasoner
+
+	mutex    sync.Mutex
+	requests map[string]chan bspl.Instance
+}
+
+// newInventoryClient makes the reasoner consume the StationInventory protocol
+func newInventoryClient(reasoner *baseReasoner) *inventoryClient {
+	ic := &inventoryClient{reasoner: reasoner}
+	ic.requests = make(map[string]chan bspl.Instance)
+	reasoner.consume(stationInventoryProtocol, ic.instantiateStationInventory, ic.updateStationInventory)
+	return ic
+}
+
+func (ic *inventoryClient) instantiateStationInventory(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
+	params, err := requireValues(values, "in operation", "in argument")
+	if err != nil {
+		return nil, err
+	}
+	i := imp.NewInstance(stationInventoryProtocol, roles)
+	i.SetValue("ID", uuid.New().String())
+	i.SetValue("operation", params["in operation"])
+	i.SetValue("argument", params["in argument"])
+	return i, nil
+}
+
+func (ic *inventoryClient) updateStationInventory(j bspl.Instance, actions []bspl.Action) error {
+	if len(actions) != 1 || actions[0].Name != "inform" {
+		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
+	}
+	ic.mutex.Lock()
+	reply, found := ic.requests[j.Key()]
+	delete(ic.requests, j.Key())
+	ic.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No pending inventory request for instance '%s'", j.Key())
+	}
+	ic.reasoner.complete(j.Key())
+	reply <- j
+	return nil
+}
+
+// query the available bikes and the coordinates of a station
+func (ic *inventoryClient) query(stationID string) (inventoryReport, error) {
+	return ic.request(stationID, inventoryQuery, noArgument)
+}
+
+// reserve a bike of a station for a TTL, the report holds the ID of
+// the bike. The reservation must be cancelled or the bike released
+// before the TTL is over.
+func (ic *inventoryClient) reserve(stationID string, ttl time.Duration) (inventoryReport, error) {
+	return ic.request(stationID, inventoryReserve, ttl.String())
+}
+
+// cancel the reservation of a bike so that it's available again
+func (ic *inventoryClient) cancel(stationID, bikeID string) error {
+	_, err := ic.request(stationID, inventoryCancel, bikeID)
+	return err
+}
+
+// release a reserved bike for a rental
+func (ic *inventoryClient) release(stationID, bikeID, rentalID string) error {
+	_, err := ic.request(stationID, inventoryRelease, bikeID+","+rentalID)
+	return err
+}
+
+func (ic *inventoryClient) request(stationID, operation, argument string) (inventoryReport, error) {
+	report := inventoryReport{}
+	node := ic.reasoner.Node
+	station, err := peer.IDB58Decode(stationID)
+	if err != nil {
+		return report, fmt.Errorf("Invalid station ID: '%s'", stationID)
+	}
+	if len(node.Peerstore().Addrs(station)) == 0 {
+		found := make(chan bool)
+		defer close(found)
+		go waitForContact(node, stationID, found)
+		_ = <-found
+	}
+	roles := bspl.Roles{"Client": node.ID().Pretty(), "Station": stationID}
+	inputs := bspl.Values{"in operation": operation, "in argument": argument}
+	instance, err := ic.reasoner.Instantiate(stationInventoryProtocol, roles, inputs)
+	if err != nil {
+		return report, err
+	}
+	node.SetInstancePeer(instance.Key(), station)
+	// the answer may arrive before the event is acknowledged
+	reply := make(chan bspl.Instance, 1)
+	ic.mutex.Lock()
+	ic.requests[instance.Key()] = reply
+	ic.mutex.Unlock()
+	ok, err := node.SendEvent(station, events.MakeNewEvent(instance))
+	if err != nil || !ok {
+		ic.forgetRequest(instance.Key())
+		ic.reasoner.DropInstance(instance.Key(), "Inventory request not delivered")
+		if err == nil {
+			err = fmt.Errorf("Station '%s' rejected the inventory request", stationID)
+		}
+		return report, err
+	}
+	var j bspl.Instance
+	select {
+	case j = <-reply:
+	// network round trips are measured in real time whatever the clock
+	case <-time.After(timeout):
+		ic.forgetRequest(instance.Key())
+		ic.reasoner.DropInstance(instance.Key(), "Inventory request timed out")
+		return report, fmt.Errorf("Station '%s' didn't answer to '%s'", stationID, operation)
+	}
+	if result := j.GetValue("result"); result != inventoryOK {
+		return report, fmt.Errorf("Station '%s' couldn't %s: %s", stationID, operation, result)
+	}
+	report.bikeID = j.GetValue("bikeID")
+	if report.available, err = typed(j).Int("available"); err != nil {
+		return report, err
+	}
+	if report.coords, err = typed(j).Coords("coordinates"); err != nil {
+		return report, err
+	}
+	if report.docks, err = typed(j).Int("docks"); err == nil && report.docks < unlimitedDocks {
+		err = fmt.Errorf("Invalid free docks: %d", report.docks)
+	}
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// forgetRequest removes a request that won't be answered
+func (ic *inventoryClient) forgetRequest(key string) {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+	delete(ic.requests, key)
+}
+
+// splitReleaseArgument returns the bike and rental IDs of a release
+func splitReleaseArgument(argument string) (string, string, error) {
+	args := strings.Split(argument, ",")
+	if len(args) != 2 || args[0] == "" || args[1] == "" {
+		return "", "", errors.New("Incorrectly formatted release argument")
+	}
+	return args[0], args[1], nil
+}
@@ -0,0 +1,314 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/events"
+	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// intents and operators of a StationSearch
+const (
+	// searchPickup looks for stations with bikes available
+	searchPickup = "pickup"
+	// searchDropoff looks for stations with free docks
+	searchDropoff = "dropoff"
+
+	// anyOperator searches the stations of every renter
+	anyOperator = "any"
+	// noOperator is registered by the stations not controlled by a
+	// renter, as values can't be left empty
+	noOperator = "none"
+)
+
+// stationEntry is a station known by a locator and the ID of the
+// renter controlling it
+type stationEntry struct {
+	id       string
+	operator string
+}
+
+// stationCandidate is a station found by a search, the renter
+// controlling it, its distance to the coordinates searched and its
+// inventory
+type stationCandidate struct {
+	station   stationInfo
+	operator  string
+	distance  float64
+	available int
+	// docks is the number of free docks, unlimitedDocks if the station
+	// has no limit
+	docks int
+}
+
+// room is the number of bikes available to pick up or of free docks to
+// drop off at the candidate
+func (c stationCandidate) room(intent string) int {
+	if intent == searchPickup {
+		return c.available
+	}
+	if c.docks == unlimitedDocks {
+		return math.MaxInt32
+	}
+	return c.docks
+}
+
+// formatCandidates as a list of stations with their ID, coordinates,
+// operator, distance, bikes available and free docks, e.g.
+// "a@1,2@r@5@3@-1;b@..."
+func formatCandidates(candidates []stationCandidate) string {
+	s := make([]string, len(candidates))
+	for i, c := range candidates {
+		s[i] = strings.Join([]string{
+			c.station.id,
+			c.station.coords.String(),
+			c.operator,
+			strconv.FormatFloat(c.distance, 'f', -1, 64),
+			strconv.Itoa(c.available),
+			strconv.Itoa(c.docks),
+		}, "@")
+	}
+	return strings.Join(s, ";")
+}
+
+// parseCandidates in the format of formatCandidates
+func parseCandidates(s string) ([]stationCandidate, error) {
+	candidates := make([]stationCandidate, 0)
+	for _, candidate := range strings.Split(s, ";") {
+		formatErr := fmt.Errorf("Incorrectly formatted station: '%s'", candidate)
+		fields := strings.Split(candidate, "@")
+		if len(fields) != 6 || fields[0] == "" || fields[2] == "" {
+			return nil, formatErr
+		}
+		c := stationCandidate{station: stationInfo{id: fields[0]}, operator: fields[2]}
+		var err error
+		if c.station.coords, err = parseCoords(fields[1]); err != nil {
+			return nil, err
+		}
+		if c.distance, err = strconv.ParseFloat(fields[3], 64); err != nil || c.distance < 0 {
+			return nil, formatErr
+		}
+		if c.available, err = strconv.Atoi(fields[4]); err != nil || c.available < 0 {
+			return nil, formatErr
+		}
+		if c.docks, err = strconv.Atoi(fields[5]); err != nil || c.docks < unlimitedDocks {
+			return nil, formatErr
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// StationPreference is how a person chooses among the stations found
+// by a search
+type StationPreference struct {
+	// Candidates is the number of stations asked for
+	Candidates int `json:"candidates"`
+	// MaxDistance in meters from the person to the station, unlimited
+	// if 0
+	MaxDistance float64 `json:"maxDistance"`
+	// Spare is the number of bikes or free docks left for others a
+	// station must have to be preferred, so that it doesn't run out
+	// before the person gets there
+	Spare int `json:"spare"`
+}
+
+// defaultStationPreference takes the nearest of 5 stations
+var defaultStationPreference = StationPreference{Candidates: 5}
+
+// Validate the parameters of the preference
+func (p StationPreference) Validate() error {
+	if p.Candidates <= 0 {
+		return errors.New("At least a candidate station must be asked for")
+	}
+	if p.MaxDistance < 0 || p.Spare < 0 {
+		return errors.New("Invalid distance or spare")
+	}
+	return nil
+}
+
+// choose the nearest candidate within reach with spare bikes or docks,
+// or else the nearest within reach
+func (p StationPreference) choose(candidates []stationCandidate, intent string) (stationCandidate, bool) {
+	reachable := make([]stationCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if (p.MaxDistance == 0 || c.distance <= p.MaxDistance) && c.room(intent) > 0 {
+			reachable = append(reachable, c)
+		}
+	}
+	if len(reachable) == 0 {
+		return stationCandidate{}, false
+	}
+	sort.SliceStable(reachable, func(i, j int) bool { return reachable[i].distance < reachable[j].distance })
+	for _, c := range reachable {
+		if c.room(intent) > p.Spare {
+			return c, true
+		}
+	}
+	return reachable[0], true
+}
+
+// stationLocator answers station searches through the StationSearch
+// protocol with the nearest stations that can serve them
+type stationLocator struct {
+	reasoner  *baseReasoner
+	inventory *inventoryClient
+	// stations returns the stations searched
+	stations func() []stationEntry
+}
+
+// newStationLocator makes the reasoner offer the StationSearch protocol
+func newStationLocator(reasoner *baseReasoner, inventory *inventoryClient, stations func() []stationEntry) *stationLocator {
+	sl := &stationLocator{reasoner: reasoner, inventory: inventory, stations: stations}
+	reasoner.offer(stationSearchProtocol, sl.registerStationSearch, nil)
+	return sl
+}
+
+func (sl *stationLocator) registerStationSearch(i bspl.Instance) error {
+	var errMsg string
+	c, err := typed(i).Coords("coordinates")
+	if err != nil {
+		errMsg = err.Error()
+	}
+	intent := i.GetValue("intent")
+	if intent == "" {
+		errMsg = "Missing parameter 'intent'"
+	}
+	limit, err := typed(i).Int("limit")
+	if err != nil {
+		errMsg = err.Error()
+	}
+	operator := i.GetValue("operator")
+	var candidates []stationCandidate
+	if errMsg == "" {
+		if candidates = sl.search(c, intent, operator); len(candidates) == 0 {
+			errMsg = fmt.Sprintf("No station for %s near %s", intent, c)
+		}
+	}
+	if errMsg != "" {
+		return sl.reasoner.reject(i, errors.New(errMsg))
+	}
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	i.SetValue("candidates", formatCandidates(candidates))
+	go sendEvent(events.MakeUpdateEvent(i), i, sl.reasoner.Node)
+	sl.reasoner.complete(i.Key())
+	return nil
+}
+
+// search the stations of an operator, or of every one, that can serve
+// an intent, nearest to c first: the ones with bikes available to pick
+// up and with free docks to drop off, and some way from c
+func (sl *stationLocator) search(c Coords, intent, operator string) []stationCandidate {
+	candidates := make([]stationCandidate, 0)
+	for _, s := range sl.stations() {
+		if operator != anyOperator && s.operator != operator {
+			continue
+		}
+		report, err := sl.inventory.query(s.id)
+		if err != nil {
+			logger.Errorf("[%s] %s", shortID(sl.reasoner.Node.ID()), err)
+			continue
+		}
+		candidate := stationCandidate{
+			station:   stationInfo{id: s.id, coords: report.coords},
+			operator:  s.operator,
+			distance:  sl.reasoner.distances.Distance(c, report.coords),
+			available: report.available,
+			docks:     report.docks,
+		}
+		if candidate.room(intent) == 0 || !reachable(candidate.distance) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	return candidates
+}
+
+// Locator is a directory of the stations registered with it, whatever
+// renter controls them, that answers station searches across them
+type Locator struct {
+	reasoner *locatorReasoner
+	Node     *nahs.Node
+}
+
+// NewLocator is the default constructor for Locator
+func NewLocator(o AgentOptions) Locator {
+	l := Locator{}
+	// the cycle of life
+	l.reasoner = newLocatorReasoner(o)
+	l.Node = net.LocalNode(l.reasoner, NodeOptions...)
+	l.reasoner.Node = l.Node
+	logger.Debugf("\tCreated locator with ID %s (%s)", shortID(l.ID()), l.ID())
+	return l
+}
+
+// ID of the locator
+func (l Locator) ID() string {
+	return l.Node.ID().Pretty()
+}
+
+// Instances of a protocol enacted by the locator in any of the given
+// states, or the open ones if no state is given
+func (l Locator) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return l.reasoner.InstancesIn(p, states...)
+}
+
+type locatorReasoner struct {
+	baseReasoner
+
+	inventory *inventoryClient
+	locator   *stationLocator
+	// registered stations and their operators, by station ID, guarded
+	// by mutex
+	registered map[string]string
+}
+
+func newLocatorReasoner(o AgentOptions) *locatorReasoner {
+	l := &locatorReasoner{baseReasoner: newBaseReasoner(o)}
+	// check the inventory of the stations, search for stations
+	l.inventory = newInventoryClient(&l.baseReasoner)
+	l.locator = newStationLocator(&l.baseReasoner, l.inventory, l.stationEntries)
+	// let stations register
+	l.offer(stationRegistryProtocol, l.registerStationRegistry, nil)
+	l.registered = make(map[string]string)
+	return l
+}
+
+func (lr *locatorReasoner) registerStationRegistry(i bspl.Instance) error {
+	stationID := i.Roles()["Station"]
+	operator := i.GetValue("operator")
+	lr.mutex.Lock()
+	lr.registered[stationID] = operator
+	lr.mutex.Unlock()
+	logger.Infof("[%s] Station %s registered by %s", shortID(lr.Node.ID()),
+		shortID(stationID), shortID(operator))
+	i.SetValue("rID", "accept")
+	go sendEvent(events.MakeUpdateEvent(i), i, lr.Node)
+	lr.complete(i.Key())
+	return nil
+}
+
+// stationEntries are the stations registered with the locator
+func (lr *locatorReasoner) stationEntries() []stationEntry {
+	lr.mutex.Lock()
+	defer lr.mutex.Unlock()
+	entries := make([]stationEntry, 0, len(lr.registered))
+	for id, operator := range lr.registered {
+		entries = append(entries, stationEntry{id: id, operator: operator})
+	}
+	// the order of the map would make ties random
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	return entries
+}
@@ -0,0 +1,143 @@
+package v2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLocator_stationSearch(t *testing.T) {
+	s := Scenario{
+		Stations: []StationSpec{
+			{Name: "near", Coords: Coords{Lat: 0, Lon: 0}, Bikes: 1, Docks: 1},
+			{Name: "far", Coords: Coords{Lat: 0.0005, Lon: 0.0005}, Bikes: 1},
+		},
+		Renters: []RenterSpec{{Name: "r", Stations: []string{"near", "far"}}},
+		People:  []PersonSpec{{Name: "p"}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := w.People["p"]
+	renter := w.Renters["r"].Node.ID()
+	near, far := w.Stations["near"].ID(), w.Stations["far"].ID()
+
+	// bikes are picked up at the near station or else at the far one
+	candidates, err := p.reasoner.stationSearch(renter, Coords{Lat: 0, Lon: 0}, searchPickup, 5, anyOperator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].station.id != near || candidates[1].station.id != far {
+		t.Fatalf("Expected the near station and the far one, got %v", candidates)
+	}
+	if c := candidates[0]; c.distance != 0 || c.available != 1 || c.docks != 0 {
+		t.Errorf("Unexpected candidate: %+v", c)
+	}
+	if c := candidates[1]; c.available != 1 || c.docks != unlimitedDocks {
+		t.Errorf("Unexpected candidate: %+v", c)
+	}
+	if candidates, _ := p.reasoner.stationSearch(renter, Coords{Lat: 0, Lon: 0}, searchPickup, 1, anyOperator); len(candidates) != 1 {
+		t.Errorf("Expected a single candidate, got %v", candidates)
+	}
+	// the near station is full, bikes are dropped at the far one
+	candidates, err = p.reasoner.stationSearch(renter, Coords{Lat: 0, Lon: 0}, searchDropoff, 5, anyOperator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].station.id != far {
+		t.Errorf("Expected only the far station, got %v", candidates)
+	}
+	// the bike of the far station can't dock at the full one
+	if err := w.Bikes[1].Dock(near); err == nil {
+		t.Error("Bike docked at a full station")
+	}
+}
+
+func TestCandidates_format(t *testing.T) {
+	candidates := []stationCandidate{
+		{station: stationInfo{id: "a", coords: Coords{Lat: 1, Lon: 2}}, operator: "r", distance: 2.5, available: 3, docks: unlimitedDocks},
+		{station: stationInfo{id: "b", coords: Coords{Lat: 3.5, Lon: -4.25}}, operator: noOperator, distance: 5, available: 0, docks: 2},
+	}
+	parsed, err := parseCandidates(formatCandidates(candidates))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, candidates) {
+		t.Errorf("Expected %v, got %v", candidates, parsed)
+	}
+	for _, s := range []string{"", "a@geo:1,2@r@2.5@3", "a@geo:1,2@@2.5@3@0", "a@geo:1,2@r@-1@3@0",
+		"a@geo:1,2@r@1@3@-2", "a@1,2@r@1@3@0"} {
+		if _, err := parseCandidates(s); err == nil {
+			t.Errorf("Invalid candidates '%s' parsed", s)
+		}
+	}
+}
+
+func TestStationPreference_choose(t *testing.T) {
+	near := stationCandidate{station: stationInfo{id: "near"}, distance: 5, available: 1, docks: 0}
+	mid := stationCandidate{station: stationInfo{id: "mid"}, distance: 10, available: 3, docks: 1}
+	far := stationCandidate{station: stationInfo{id: "far"}, distance: 50, available: 8, docks: unlimitedDocks}
+	candidates := []stationCandidate{far, mid, near}
+
+	tests := []struct {
+		preference StationPreference
+		intent     string
+		expected   string
+	}{
+		{StationPreference{}, searchPickup, "near"},
+		{StationPreference{Spare: 1}, searchPickup, "mid"},
+		{StationPreference{Spare: 5}, searchPickup, "far"},
+		// no station within reach has spare bikes
+		{StationPreference{Spare: 5, MaxDistance: 20}, searchPickup, "near"},
+		{StationPreference{}, searchDropoff, "mid"},
+		{StationPreference{Spare: 1}, searchDropoff, "far"},
+	}
+	for _, test := range tests {
+		c, found := test.preference.choose(candidates, test.intent)
+		if !found || c.station.id != test.expected {
+			t.Errorf("%+v to %s: expected %s, got %s", test.preference, test.intent, test.expected, c.station.id)
+		}
+	}
+	if _, found := (StationPreference{MaxDistance: 1}).choose(candidates, searchPickup); found {
+		t.Error("Chose a station out of reach")
+	}
+}
+
+func TestLocator_search(t *testing.T) {
+	s := Scenario{
+		Stations: []StationSpec{
+			{Name: "a", Coords: Coords{Lat: 0, Lon: 0}, Bikes: 1},
+			{Name: "b", Coords: Coords{Lat: 0, Lon: 0.0001}, Bikes: 1},
+		},
+		Renters: []RenterSpec{
+			{Name: "r1", Stations: []string{"a"}},
+			{Name: "r2", Stations: []string{"b"}},
+		},
+		Locators: []LocatorSpec{{Name: "l", Stations: []string{"a", "b"}}},
+		People:   []PersonSpec{{Name: "p", Locator: "l"}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := w.People["p"]
+	locator := w.Locators["l"].Node.ID()
+	r1, r2 := w.Renters["r1"].ID(), w.Renters["r2"].ID()
+
+	// the stations of every renter are found
+	candidates, err := p.reasoner.stationSearch(locator, Coords{Lat: 0, Lon: 0}, searchPickup, 5, anyOperator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].operator != r1 || candidates[1].operator != r2 {
+		t.Fatalf("Expected the stations of both renters, got %v", candidates)
+	}
+	// or only the ones of a renter
+	station, err := p.reasoner.findStation(w.Renters["r2"].Node.ID(), Coords{Lat: 0, Lon: 0}, searchPickup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if station.id != w.Stations["b"].ID() {
+		t.Errorf("Expected the station of the second renter, got %s", station.id)
+	}
+}
@@ -0,0 +1,121 @@
+package v2
+
+import (
+	"errors"
+	"math"
+)
+
+// negotiationDecision is what a party does in a round of a negotiation
+type negotiationDecision int
+
+const (
+	negotiationAccept negotiationDecision = iota
+	negotiationCounter
+	negotiationReject
+)
+
+// rID of each decision in the answers of the BikeNegotiation protocol
+func (d negotiationDecision) String() string {
+	switch d {
+	case negotiationAccept:
+		return "accept"
+	case negotiationCounter:
+		return "counter"
+	}
+	return "reject"
+}
+
+// BuyerStrategy concedes from an opening bid towards a reservation
+// price, the highest price the client accepts
+type BuyerStrategy struct {
+	Reservation float64 `json:"reservation"`
+	Opening     float64 `json:"opening"`
+	// Concession is the fraction of the gap between the opening bid
+	// and the reservation price conceded each round
+	Concession float64 `json:"concession"`
+	// Rounds is the maximum number of counters
+	Rounds int `json:"rounds"`
+}
+
+// defaultBuyer accepts any price up to 0.2 without negotiating
+var defaultBuyer = BuyerStrategy{Reservation: 0.2, Opening: 0.2}
+
+// Validate the parameters of the strategy
+func (s BuyerStrategy) Validate() error {
+	if s.Reservation < 0 || s.Opening < 0 || s.Opening > s.Reservation {
+		return errors.New("The opening bid must be between 0 and the reservation price")
+	}
+	if s.Concession < 0 || s.Concession > 1 || s.Rounds < 0 {
+		return errors.New("Invalid concession or rounds")
+	}
+	return nil
+}
+
+// bid of a round, starting from the first one
+func (s BuyerStrategy) bid(round int) float64 {
+	conceded := math.Min(1, s.Concession*float64(round-1))
+	return roundPrice(s.Opening + (s.Reservation-s.Opening)*conceded)
+}
+
+// respond to the price asked by the renter after a number of counter
+// rounds. Final asks can't be countered.
+func (s BuyerStrategy) respond(ask float64, round int, final bool) (negotiationDecision, float64) {
+	if round < s.Rounds && !final {
+		next := s.bid(round + 1)
+		if ask <= next {
+			return negotiationAccept, ask
+		}
+		return negotiationCounter, next
+	}
+	if ask <= s.Reservation {
+		return negotiationAccept, ask
+	}
+	return negotiationReject, ask
+}
+
+// SellerStrategy concedes from the offered price towards a reservation
+// price, the lowest price the renter accepts
+type SellerStrategy struct {
+	// Discount is the fraction of the offered price the renter may give
+	// up at most, which sets the reservation price
+	Discount float64 `json:"discount"`
+	// Concession is the fraction of the gap between the offered and
+	// the reservation price conceded each round
+	Concession float64 `json:"concession"`
+	// Rounds is the number of counters answered before the ask is final
+	Rounds int `json:"rounds"`
+}
+
+// defaultSeller doesn't give up on the offered price
+var defaultSeller = SellerStrategy{}
+
+// Validate the parameters of the strategy
+func (s SellerStrategy) Validate() error {
+	if s.Discount < 0 || s.Discount > 1 {
+		return errors.New("The discount must be between 0 and 1")
+	}
+	if s.Concession < 0 || s.Concession > 1 || s.Rounds < 0 {
+		return errors.New("Invalid concession or rounds")
+	}
+	return nil
+}
+
+// ask of a round given the offered price
+func (s SellerStrategy) ask(offer float64, round int) float64 {
+	reservation := offer * (1 - s.Discount)
+	conceded := math.Min(1, s.Concession*float64(round))
+	return roundPrice(offer - (offer-reservation)*conceded)
+}
+
+// respond to the bid of a client in a round, returns the price the
+// renter is asking for from then on
+func (s SellerStrategy) respond(offer, bid float64, round int) (negotiationDecision, float64) {
+	ask := s.ask(offer, round)
+	if bid >= ask {
+		return negotiationAccept, bid
+	}
+	if round >= s.Rounds {
+		return negotiationReject, ask
+	}
+	return negotiationCounter, ask
+}
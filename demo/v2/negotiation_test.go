@@ -0,0 +1,66 @@
+package v2
+
+import "testing"
+
+func TestNegotiation(t *testing.T) {
+	buyer := BuyerStrategy{Reservation: 0.04, Opening: 0.02, Concession: 0.5, Rounds: 3}
+	seller := SellerStrategy{Discount: 0.4, Concession: 0.5, Rounds: 2}
+	offer := 0.05
+
+	decision, price := buyer.respond(offer, 0, false)
+	round := 0
+	for decision == negotiationCounter {
+		round++
+		var answer negotiationDecision
+		answer, price = seller.respond(offer, price, round)
+		if answer == negotiationAccept {
+			decision = negotiationAccept
+			break
+		}
+		decision, price = buyer.respond(price, round, answer == negotiationReject)
+	}
+	if decision != negotiationAccept || price != 0.03 || round != 2 {
+		t.Errorf("Expected agreement at 0.03 in round 2, got %s at %v in round %d",
+			decision, price, round)
+	}
+}
+
+func TestBuyerStrategy_respond(t *testing.T) {
+	buyer := BuyerStrategy{Reservation: 0.04, Opening: 0.02, Concession: 0.5, Rounds: 1}
+	tests := []struct {
+		ask      float64
+		round    int
+		final    bool
+		decision negotiationDecision
+		price    float64
+	}{
+		{0.01, 0, false, negotiationAccept, 0.01},
+		{0.05, 0, false, negotiationCounter, 0.02},
+		{0.04, 1, false, negotiationAccept, 0.04},
+		{0.05, 1, false, negotiationReject, 0.05},
+		{0.03, 0, true, negotiationAccept, 0.03},
+	}
+	for _, test := range tests {
+		decision, price := buyer.respond(test.ask, test.round, test.final)
+		if decision != test.decision || price != test.price {
+			t.Errorf("Ask %v in round %d: expected %s %v, got %s %v", test.ask, test.round,
+				test.decision, test.price, decision, price)
+		}
+	}
+	if decision, _ := defaultBuyer.respond(0.2, 0, false); decision != negotiationAccept {
+		t.Error("The default strategy must accept prices up to 0.2")
+	}
+	if decision, _ := defaultBuyer.respond(0.21, 0, false); decision != negotiationReject {
+		t.Error("The default strategy must reject prices over 0.2")
+	}
+}
+
+func TestSellerStrategy_respond(t *testing.T) {
+	if decision, price := defaultSeller.respond(0.03, 0.02, 1); decision != negotiationReject || price != 0.03 {
+		t.Errorf("Expected the default strategy to insist on 0.03, got %s %v", decision, price)
+	}
+	seller := SellerStrategy{Discount: 0.5, Concession: 1, Rounds: 1}
+	if decision, price := seller.respond(0.04, 0.02, 1); decision != negotiationAccept || price != 0.02 {
+		t.Errorf("Expected to accept 0.02, got %s %v", decision, price)
+	}
+}
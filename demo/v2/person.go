@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -12,6 +13,8 @@ import (
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 // Person is an agent representing human person
@@ -21,12 +24,12 @@ type Person struct {
 }
 
 // NewPerson is the default constructor for Person
-func NewPerson() Person {
+func NewPerson(o AgentOptions) Person {
 	p := Person{}
 	// the cycle of life
-	p.reasoner = newPersonReasoner()
+	p.reasoner = newPersonReasoner(o)
 	//p.Node = nahs.NewNode(p.reasoner)
-	p.Node = net.LocalNode(p.reasoner)
+	p.Node = net.LocalNode(p.reasoner, NodeOptions...)
 	p.reasoner.Node = p.Node
 
 	logger.Debugf("\tCreated person with ID %s (%s)", shortID(p.ID()), p.ID())
@@ -38,342 +41,590 @@ func (p Person) ID() string {
 	return p.Node.ID().Pretty()
 }
 
-// Travel from src to dst
-func (p Person) Travel(src Coords, dst Coords) error {
+// Instances of a protocol enacted by the person in any of the given
+// states, or the open ones if no state is given
+func (p Person) Instances(protocol bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return p.reasoner.InstancesIn(protocol, states...)
+}
 
-	// find nearest station
-	logger.Infof("\t[%s] Search for station", shortID(p.ID()))
-	result := make(chan string)
-	errc := make(chan error)
-	defer close(result)
-	defer close(errc)
-	go p.reasoner.stationSearch(src, result, errc)
-	var station string
-	select {
-	case station = <-result:
-		logger.Infof("\t[%s] Nearest station found: %s", shortID(p.ID()), shortID(station))
-	case err := <-errc:
-		logger.Errorf("\t[%s] Couldn't find station: %s", shortID(p.ID()), err)
-		return err
+// SetNegotiation sets the strategy the person answers the prices
+// offered for bikes with
+func (p Person) SetNegotiation(strategy BuyerStrategy) {
+	p.reasoner.mutex.Lock()
+	defer p.reasoner.mutex.Unlock()
+	p.reasoner.negotiation = strategy
+}
+
+// SetStationPreference sets how the person chooses among the stations
+// found to pick up and drop off bikes
+func (p Person) SetStationPreference(preference StationPreference) {
+	p.reasoner.mutex.Lock()
+	defer p.reasoner.mutex.Unlock()
+	p.reasoner.stationPreference = preference
+}
+
+// SetLocator sets the locator the person searches the stations of
+// every renter with, each renter is asked for its own stations if not
+// set
+func (p Person) SetLocator(locatorID string) error {
+	locator, err := peer.IDB58Decode(locatorID)
+	if err != nil {
+		return fmt.Errorf("Invalid locator ID: '%s'", locatorID)
 	}
+	p.reasoner.mutex.Lock()
+	defer p.reasoner.mutex.Unlock()
+	p.reasoner.locator = locator
+	return nil
+}
 
-	// request bike from station
-	rID := p.reasoner.bikeRental(station, "", result, errc)
-	var bikeID string
-	select {
-	case bikeID = <-result:
-		if bikeID == "" {
-			errMsg := "Bike found but rejected."
-			return errors.New(errMsg)
-		}
-		logger.Infof("\t[%s] Bike with id %s rented", shortID(p.ID()), shortID(bikeID))
-	case err := <-errc:
+// SetShopping sets the strategy the person chooses among the bikes
+// offered by every renter with
+func (p Person) SetShopping(strategy ShoppingStrategy) {
+	p.reasoner.mutex.Lock()
+	defer p.reasoner.mutex.Unlock()
+	p.reasoner.shopping = strategy
+}
+
+// Travel from src to dst
+func (p Person) Travel(src Coords, dst Coords) error {
+
+	// rent the best bike offered near src
+	logger.Infof("\t[%s] Search for bikes", shortID(p.ID()))
+	rental, err := p.reasoner.rentBike(src, dst)
+	if err != nil {
 		logger.Errorf("\t[%s] Couldn't rent bike: %s", shortID(p.ID()), err)
 		return err
 	}
+	bikeID := rental.GetValue("bikeID")
+	logger.Infof("\t[%s] Bike with id %s rented", shortID(p.ID()), shortID(bikeID))
 
 	// pick the bike
-	p.reasoner.pickBike(bikeID, rID)
+	p.reasoner.pickBike(bikeID, rental.GetValue("ID"))
 
 	// ride bike
 
-	// find a place to drop the bike
-	go p.reasoner.stationSearch(dst, result, errc)
-	select {
-	case station = <-result:
-		logger.Infof("\t[%s] Nearest station found: %s", shortID(p.ID()), shortID(station))
-	case err := <-errc:
+	// find a station of the renter to drop the bike at
+	renter, err := typed(rental).RolePeer("Renter")
+	if err != nil {
+		return err
+	}
+	station, err := p.reasoner.findStation(renter, dst, searchDropoff)
+	if err != nil {
 		logger.Errorf("\t[%s] Couldn't find station: %s", shortID(p.ID()), err)
 		return err
 	}
-	logger.Infof("\t[%s] Dropping bike %s at station %s", shortID(p.ID()), shortID(bikeID), shortID(station))
+	logger.Infof("\t[%s] Station with free docks found: %s", shortID(p.ID()), shortID(station.id))
+	logger.Infof("\t[%s] Dropping bike %s at station %s", shortID(p.ID()), shortID(bikeID), shortID(station.id))
 
 	// drop the bike
-	p.reasoner.dropBike(station)
+	p.reasoner.dropBike(station.id)
 
 	return nil
 }
 
 type personReasoner struct {
-	Node *nahs.Node
-
-	offeredServices  map[string]bspl.Protocol
-	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
-
-	stationSearches map[string]chan string
-	rentalRequests  map[string]chan string
-
-	maxPrice        float64
+	baseReasoner
+
+	// stationSearches are the searches waiting for the stations found
+	stationSearches map[string]chan []stationCandidate
+	// pendingRentals are the rentals waiting for an offer
+	pendingRentals map[string]pendingRental
+	// rentalRequests are the rentals waiting for the person to decide
+	rentalRequests map[string]chan string
+	// negotiations maps the IDs of the rentals being negotiated
+	// to the keys of their instances
+	negotiations map[string]string
+
+	negotiation       BuyerStrategy
+	shopping          ShoppingStrategy
+	stationPreference StationPreference
+	// locator searched for the stations of every renter, if any
+	locator         peer.ID
 	currentBikeRide string
 }
 
-func newPersonReasoner() *personReasoner {
-	p := &personReasoner{}
-	// initialize maps
-	p.offeredServices = make(map[string]bspl.Protocol)
-	p.openInstances = make(map[string]bspl.Instance)
-	p.droppedInstances = make(map[string]bspl.Instance)
-	// rent bike, ride bike, search for a near station
-	p.consumedServices = map[string]bspl.Protocol{
-		bikeRentalProtocol.Key():    bikeRentalProtocol,
-		bikeRequestProtocol.Key():   bikeRideProtocol,
-		bikeRideProtocol.Key():      bikeRideProtocol,
-		stationSearchProtocol.Key(): stationSearchProtocol,
-	}
-
-	p.stationSearches = make(map[string]chan string)
-	p.rentalRequests = make(map[string]chan string)
-
-	p.maxPrice = 0.2
-
-	return p
+// shoppingSession collects the offers for the bikes requested to
+// every renter, offers arriving once it is closed are rejected
+type shoppingSession struct {
+	offers chan rentalOffer
+	closed bool
 }
 
-// DropInstance cancels an Instance for whatever motive
-func (pr *personReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := pr.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
-	}
-	pr.droppedInstances[instanceKey] = instance
-	delete(pr.openInstances, instanceKey)
-	return nil
+// pendingRental is a bike requested at a station in a session
+type pendingRental struct {
+	session *shoppingSession
+	station stationInfo
 }
 
-// GetInstance returns an Instance given the instance key
-func (pr *personReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	instance, found := pr.openInstances[instanceKey]
-	return instance, found
-}
+func newPersonReasoner(o AgentOptions) *personReasoner {
+	p := &personReasoner{baseReasoner: newBaseReasoner(o)}
+	// rent bike, ride bike, search for a near station
+	p.consume(bikeRentalProtocol, p.instantiateBikeRental, p.updateBikeRental)
+	p.onDrop(bikeRentalProtocol, p.dropBikeRental)
+	p.consume(bikeRideProtocol, p.instantiateBikeRide, nil)
+	p.consume(stationSearchProtocol, p.instantiateStationSearch, p.updateStationSearch)
+	p.onDrop(stationSearchProtocol, p.dropStationSearch)
+	// negotiate the price of the rentals
+	p.consume(bikeNegotiationProtocol, p.instantiateBikeNegotiation, p.updateBikeNegotiation)
+
+	p.stationSearches = make(map[string]chan []stationCandidate)
+	p.pendingRentals = make(map[string]pendingRental)
+	p.rentalRequests = make(map[string]chan string)
+	p.negotiations = make(map[string]string)
 
-// All instances of a Protocol
-func (pr *personReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	instances := make([]bspl.Instance, len(pr.openInstances))
-	i := 0
-	for _, v := range pr.openInstances {
-		instances[i] = v
-		i++
-	}
-	return instances
-}
+	p.negotiation = defaultBuyer
+	p.shopping = defaultShopping
+	p.stationPreference = defaultStationPreference
 
-// Instantiate a protocol. Check if the assigned role is a role
-// the reasoner is willing to play.
-func (pr *personReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
-	if _, consumed := pr.consumedServices[p.Key()]; !consumed {
-		return nil, fmt.Errorf("Protocol '%s' not supported by this Node", p.Key())
-	}
-	switch p.Key() {
-	case bikeRentalProtocol.Key():
-		return pr.instantiateBikeRental(roles, ins)
-	case bikeRideProtocol.Key():
-		return pr.instantiateBikeRide(roles, ins)
-	case stationSearchProtocol.Key():
-		return pr.instantiateStationSearch(roles, ins)
-	}
-	return nil, fmt.Errorf("Unkown protocol '%s'", p.Key())
+	return p
 }
 
 func (pr *personReasoner) instantiateBikeRental(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
-	id := uuid.New().String()
-	params := make(map[string]string)
-	required := []string{"in origin", "in destination"}
-	for _, r := range required {
-		v, found := values[r]
-		if !found {
-			return nil, fmt.Errorf("Missing parameter: '%s'", r)
-		}
-		params[r] = v
+	params, err := requireValues(values, "in origin", "in destination")
+	if err != nil {
+		return nil, err
 	}
-	params["out ID key"] = id
 	i := imp.NewInstance(bikeRentalProtocol, roles)
-	i.SetValue("ID", id)
+	i.SetValue("ID", uuid.New().String())
 	i.SetValue("destination", params["in destination"])
 	i.SetValue("origin", params["in origin"])
-	pr.openInstances[i.Key()] = i
+	return i, nil
+}
+
+func (pr *personReasoner) instantiateBikeNegotiation(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
+	params, err := requireValues(values, "in rentalID", "in round", "in bid")
+	if err != nil {
+		return nil, err
+	}
+	i := imp.NewInstance(bikeNegotiationProtocol, roles)
+	i.SetValue("rentalID", params["in rentalID"])
+	i.SetValue("round", params["in round"])
+	i.SetValue("bid", params["in bid"])
 	return i, nil
 }
 
 func (pr *personReasoner) instantiateBikeRide(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
-	id := uuid.New().String()
-	params := make(map[string]string)
-	required := []string{"in rentalID"}
-	for _, r := range required {
-		v, found := values[r]
-		if !found {
-			return nil, fmt.Errorf("Missing parameter: '%s'", r)
-		}
-		params[r] = v
+	params, err := requireValues(values, "in rentalID")
+	if err != nil {
+		return nil, err
 	}
 	i := imp.NewInstance(bikeRideProtocol, roles)
-	i.SetValue("ID", id)
+	i.SetValue("ID", uuid.New().String())
 	i.SetValue("rentalID", params["in rentalID"])
-	pr.openInstances[i.Key()] = i
 	return i, nil
 }
 
 func (pr *personReasoner) instantiateStationSearch(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
-	id := uuid.New().String()
-	params := make(map[string]string)
-	required := []string{"in coordinates"}
-	for _, r := range required {
-		v, found := values[r]
-		if !found {
-			return nil, fmt.Errorf("Missing parameter: '%s'", r)
-		}
-		params[r] = v
+	params, err := requireValues(values, "in coordinates", "in intent", "in limit", "in operator")
+	if err != nil {
+		return nil, err
 	}
-	params["out ID key"] = id
 	i := imp.NewInstance(stationSearchProtocol, roles)
-	i.SetValue("ID", id)
+	i.SetValue("ID", uuid.New().String())
 	i.SetValue("coordinates", params["in coordinates"])
-	pr.openInstances[i.Key()] = i
+	i.SetValue("intent", params["in intent"])
+	i.SetValue("limit", params["in limit"])
+	i.SetValue("operator", params["in operator"])
 	return i, nil
 }
 
-// RegisterInstance registers an Instance created by another Reasoner
-func (pr *personReasoner) RegisterInstance(i bspl.Instance) error {
+func (pr *personReasoner) updateStationSearch(i bspl.Instance, actions []bspl.Action) error {
+	if len(actions) != 1 || actions[0].Name != "inform" {
+		return fmt.Errorf("Invalid update for instance '%s'", i.Key())
+	}
+	candidates, err := parseCandidates(i.GetValue("candidates"))
+	if err != nil {
+		return fmt.Errorf("Invalid candidates for instance '%s': %s", i.Key(), err)
+	}
+	pr.mutex.Lock()
+	result, found := pr.stationSearches[i.Key()]
+	delete(pr.stationSearches, i.Key())
+	pr.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No pending search for instance '%s'", i.Key())
+	}
+	pr.complete(i.Key())
+	result <- candidates
+	return nil
+}
+
+// dropStationSearch stops waiting for a search no station could serve
+func (pr *personReasoner) dropStationSearch(i bspl.Instance, motive string) {
+	pr.mutex.Lock()
+	result, found := pr.stationSearches[i.Key()]
+	delete(pr.stationSearches, i.Key())
+	pr.mutex.Unlock()
+	logger.Debugf("[%s] Station search '%s' dropped: %s", shortID(pr.Node.ID()), i.Key(), motive)
+	if found {
+		result <- nil
+	}
+}
+
+func (pr *personReasoner) updateBikeRental(j bspl.Instance, actions []bspl.Action) error {
+	if len(actions) != 1 || actions[0].Name != "offer" {
+		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
+	}
+	price, err := typed(j).Float("price")
+	if err != nil {
+		return pr.reject(j, err)
+	}
+	if _, err := typed(j).Peer("bikeID"); err != nil {
+		return pr.reject(j, err)
+	}
+	bikeID := j.GetValue("bikeID")
+	logger.Debugf("[%s] Received offer for bike %s at price: '%.4f'",
+		shortID(pr.Node.ID()), shortID(bikeID), price)
+	pr.mutex.Lock()
+	pending, found := pr.pendingRentals[j.Key()]
+	delete(pr.pendingRentals, j.Key())
+	late := found && pending.session.closed
+	if found && !late {
+		// buffered for every renter of the session, the rental is
+		// copied as the instance is updated once the handler returns
+		offer := rentalOffer{rental: copyInstance(j), price: price, station: pending.station}
+		pending.session.offers <- offer
+	}
+	pr.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No pending rental for instance '%s'", j.Key())
+	}
+	if late {
+		logger.Debugf("[%s] Offer for bike %s arrived too late", shortID(pr.Node.ID()), shortID(bikeID))
+		go pr.answerRental(copyInstance(j), negotiationReject, 0)
+	}
 	return nil
 }
 
-// UpdateInstance updates an instance with a newer version of itself
-// as long as a valid run from one to the other.
-func (pr *personReasoner) UpdateInstance(newVersion bspl.Instance) error {
-	i, found := pr.openInstances[newVersion.Key()]
+func (pr *personReasoner) updateBikeNegotiation(j bspl.Instance, actions []bspl.Action) error {
+	if len(actions) != 1 || actions[0].Name != "answer" {
+		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
+	}
+	pr.mutex.Lock()
+	rentalKey, found := pr.negotiations[j.GetValue("rentalID")]
+	delete(pr.negotiations, j.GetValue("rentalID"))
+	pr.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No pending negotiation for instance '%s'", j.Key())
+	}
+	pr.complete(j.Key())
+	rental, found := pr.GetInstance(rentalKey)
 	if !found {
-		return fmt.Errorf("Instance not found: '%s'", newVersion.Key())
+		return fmt.Errorf("Instance with key '%s' not found", rentalKey)
+	}
+	price, err := typed(j).Float("price")
+	round, roundErr := typed(j).Int("round")
+	if err != nil || roundErr != nil {
+		pr.closeRental(rental, negotiationReject, 0)
+		return fmt.Errorf("Invalid answer for instance '%s'", j.Key())
+	}
+	logger.Debugf("[%s] Renter answered '%s' at price '%.4f' in round %d",
+		shortID(pr.Node.ID()), j.GetValue("rID"), price, round)
+	switch j.GetValue("rID") {
+	case negotiationAccept.String():
+		pr.closeRental(rental, negotiationAccept, price)
+	case negotiationCounter.String():
+		pr.respondToAsk(rental, price, round, false)
+	default:
+		// the price asked is final
+		pr.respondToAsk(rental, price, round, true)
+	}
+	return nil
+}
+
+// respondToAsk answers the price asked for a rental after a number of
+// counter rounds, accepting or rejecting the rental or countering it
+func (pr *personReasoner) respondToAsk(rental bspl.Instance, ask float64, round int, final bool) {
+	pr.mutex.Lock()
+	decision, price := pr.negotiation.respond(ask, round, final)
+	pr.mutex.Unlock()
+	if decision != negotiationCounter {
+		logger.Debugf("[%s] Decided to %s price '%.4f'", shortID(pr.Node.ID()), decision, price)
+		pr.closeRental(rental, decision, price)
+		return
+	}
+	if err := pr.counter(rental, round+1, price); err != nil {
+		logger.Errorf("[%s] Couldn't counter offer: %s", shortID(pr.Node.ID()), err)
+		pr.closeRental(rental, negotiationReject, 0)
 	}
-	actions, _, err := i.Diff(newVersion)
+}
+
+// counter the price asked for a rental with a bid
+func (pr *personReasoner) counter(rental bspl.Instance, round int, bid float64) error {
+	renter := rental.Roles()["Renter"]
+	id, err := typed(rental).RolePeer("Renter")
 	if err != nil {
 		return err
 	}
-	switch i.Protocol().Key() {
-	case bikeRentalProtocol.Key():
-		err = pr.updateBikeRental(i, newVersion, actions)
-	case stationSearchProtocol.Key():
-		err = pr.updateStationSearch(newVersion, actions)
-	default:
-		err = fmt.Errorf("Unkown protocol in update: %s", i.Protocol().Key())
+	roles := bspl.Roles{"Client": pr.Node.ID().Pretty(), "Renter": renter}
+	inputs := bspl.Values{
+		"in rentalID": rental.GetValue("ID"),
+		"in round":    strconv.Itoa(round),
+		"in bid":      formatPrice(bid),
 	}
+	i, err := pr.Instantiate(bikeNegotiationProtocol, roles, inputs)
 	if err != nil {
 		return err
 	}
-	i.Update(newVersion)
+	pr.Node.SetInstancePeer(i.Key(), id)
+	// the answer may arrive before the event is acknowledged
+	pr.mutex.Lock()
+	pr.negotiations[rental.GetValue("ID")] = rental.Key()
+	pr.mutex.Unlock()
+	logger.Debugf("[%s] Counter with bid '%s' in round %d",
+		shortID(pr.Node.ID()), formatPrice(bid), round)
+	go sendEvent(events.MakeNewEvent(i), i, pr.Node)
 	return nil
 }
 
-func (pr *personReasoner) updateStationSearch(i bspl.Instance, actions []bspl.Action) error {
-	if len(actions) != 1 && actions[0].Name != "stationID" {
-		return fmt.Errorf("Missing station ID for instance '%s'", i.Key())
+// closeRental accepts the bike offered in a rental the person is
+// deciding on at the price agreed, or rejects it
+func (pr *personReasoner) closeRental(rental bspl.Instance, decision negotiationDecision, price float64) {
+	pr.mutex.Lock()
+	result, found := pr.rentalRequests[rental.Key()]
+	delete(pr.rentalRequests, rental.Key())
+	pr.mutex.Unlock()
+	if !found {
+		logger.Errorf("[%s] No pending rental for instance '%s'", shortID(pr.Node.ID()), rental.Key())
+		return
+	}
+	// the bike can't be ridden unless the renter gets the acceptance
+	delivered := pr.answerRental(rental, decision, price)
+	if decision == negotiationAccept && delivered {
+		result <- rental.GetValue("bikeID")
+	} else {
+		result <- ""
 	}
-	stationID := i.GetValue("stationID")
-	pr.stationSearches[i.Key()] <- stationID
-	return nil
 }
 
-func (pr *personReasoner) updateBikeRental(i, j bspl.Instance, actions []bspl.Action) error {
-	if len(actions) != 1 && actions[0].Name != "offer" {
-		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
+// answerRental accepts the bike offered in a rental at the price
+// agreed, or rejects it, and returns whether the renter got the answer.
+// Dropped rentals aren't answered.
+func (pr *personReasoner) answerRental(rental bspl.Instance, decision negotiationDecision, price float64) bool {
+	if err := pr.instances.Complete(rental.Key()); err != nil {
+		logger.Debugf("[%s] Rental '%s' already closed", shortID(pr.Node.ID()), rental.Key())
+		return false
+	}
+	rID := negotiationReject.String()
+	if decision == negotiationAccept {
+		rID = negotiationAccept.String()
+		rental.SetValue("agreed", formatPrice(price))
+	}
+	rental.SetValue("rID", rID)
+	renter := counterpart(rental, pr.Node)
+	ok, err := pr.Node.SendEvent(renter, events.MakeUpdateEvent(rental))
+	if err != nil || !ok {
+		logger.Errorf("[%s] Renter %s didn't take the answer to rental '%s'",
+			shortID(pr.Node.ID()), shortID(renter), rental.Key())
+		return false
+	}
+	return true
+}
+
+// dropBikeRental stops waiting for the offer or the
+// decision on a rental dropped by the person or the renter
+func (pr *personReasoner) dropBikeRental(i bspl.Instance, motive string) {
+	pr.mutex.Lock()
+	delete(pr.pendingRentals, i.Key())
+	result, deciding := pr.rentalRequests[i.Key()]
+	delete(pr.rentalRequests, i.Key())
+	pr.mutex.Unlock()
+	logger.Debugf("[%s] Rental '%s' dropped: %s", shortID(pr.Node.ID()), i.Key(), motive)
+	if deciding {
+		result <- ""
+	}
+}
+
+// rentBike requests a bike to every renter at the station near src
+// the person prefers, collects the offers until the deadline of the shopping
+// strategy and rents the best one the person agrees on
+func (pr *personReasoner) rentBike(src, dst Coords) (bspl.Instance, error) {
+	renters := demo.FindContacts(pr.Node, bikeRentalProtocol.Key(), "Renter")
+	if len(renters) == 0 {
+		return nil, errors.New("No renters found")
+	}
+	pr.mutex.Lock()
+	shopping := pr.shopping
+	pr.mutex.Unlock()
+	session := &shoppingSession{offers: make(chan rentalOffer, len(renters))}
+	failures := make(chan error, len(renters))
+	for _, id := range renters {
+		go func(id peer.ID) {
+			if err := pr.requestBike(id, src, dst, session); err != nil {
+				failures <- fmt.Errorf("Renter %s: %s", shortID(id), err)
+			}
+		}(id)
+	}
+	offers := make([]rentalOffer, 0, len(renters))
+	deadline := time.After(shopping.Deadline)
+collect:
+	for answered := 0; answered < len(renters); answered++ {
+		select {
+		case o := <-session.offers:
+			offers = append(offers, o)
+		case err := <-failures:
+			logger.Errorf("[%s] %s", shortID(pr.Node.ID()), err)
+		case <-deadline:
+			break collect
+		}
+	}
+	offers = append(offers, pr.closeSession(session)...)
+	logger.Infof("[%s] Received %d offers from %d renters", shortID(pr.Node.ID()), len(offers), len(renters))
+
+	ranked, unreachable := shopping.rank(offers, src, pr.distances)
+	for _, o := range unreachable {
+		logger.Infof("[%s] No way to station %s", shortID(pr.Node.ID()), shortID(o.station.id))
+		pr.answerRental(o.rental, negotiationReject, 0)
+	}
+	for k, o := range ranked {
+		if !pr.decide(o) {
+			continue
+		}
+		for _, other := range ranked[k+1:] {
+			pr.answerRental(other.rental, negotiationReject, 0)
+		}
+		return o.rental, nil
+	}
+	if len(offers) == 0 {
+		return nil, errors.New("No bikes offered")
 	}
-	priceStr := j.GetValue("price")
-	price, err := strconv.ParseFloat(priceStr, 64)
+	return nil, errors.New("Bikes found but rejected")
+}
+
+// requestBike requests a bike to a renter at the station near src the
+// person prefers
+func (pr *personReasoner) requestBike(renter peer.ID, src, dst Coords, session *shoppingSession) error {
+	station, err := pr.findStation(renter, src, searchPickup)
 	if err != nil {
-		errMsg := "Error parsing price"
-		go sendEvent(events.MakeDropEvent(j.Key(), errMsg), j, pr.Node)
 		return err
 	}
-	bikeID := j.GetValue("bikeID")
-	if bikeID == "" {
-		errMsg := "Missing bike ID"
-		go sendEvent(events.MakeDropEvent(j.Key(), errMsg), j, pr.Node)
-		return errors.New(errMsg)
+	return pr.bikeRental(renter, station, dst.String(), session)
+}
+
+// closeSession stops collecting offers and returns the ones
+// collected but not read yet
+func (pr *personReasoner) closeSession(session *shoppingSession) []rentalOffer {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	session.closed = true
+	for key, pending := range pr.pendingRentals {
+		if pending.session == session {
+			delete(pr.pendingRentals, key)
+		}
+	}
+	offers := make([]rentalOffer, 0)
+	for {
+		select {
+		case o := <-session.offers:
+			offers = append(offers, o)
+		default:
+			return offers
+		}
+	}
+}
+
+// decide on an offer, negotiating its price, and
+// return whether the person accepted it
+func (pr *personReasoner) decide(o rentalOffer) bool {
+	result := make(chan string, 1)
+	pr.mutex.Lock()
+	pr.rentalRequests[o.rental.Key()] = result
+	pr.mutex.Unlock()
+	pr.respondToAsk(o.rental, o.price, 0, false)
+	return <-result != ""
+}
+
+func (pr *personReasoner) bikeRental(renter peer.ID, station stationInfo, destination string, session *shoppingSession) error {
+	roles := bspl.Roles{"Client": pr.Node.ID().Pretty(), "Renter": renter.Pretty()}
+	inputs := bspl.Values{"in origin": station.id, "in destination": destination}
+	instance, err := pr.Instantiate(bikeRentalProtocol, roles, inputs)
+	if err != nil {
+		return err
+	}
+	pr.Node.SetInstancePeer(instance.Key(), renter)
+	// the offer may arrive before the event is acknowledged
+	pr.mutex.Lock()
+	if session.closed {
+		pr.mutex.Unlock()
+		return errors.New("Too late to request a bike")
+	}
+	pr.pendingRentals[instance.Key()] = pendingRental{session: session, station: station}
+	pr.mutex.Unlock()
+	logger.Infof("[%s] Sent rent request to %s", shortID(pr.Node.ID()), shortID(renter))
+	ok, err := pr.Node.SendEvent(renter, events.MakeNewEvent(instance))
+	if err == nil && !ok {
+		err = rejectedBy("Renter", renter, instance.Key())
+	}
+	if err != nil {
+		pr.mutex.Lock()
+		delete(pr.pendingRentals, instance.Key())
+		pr.mutex.Unlock()
+		return err
 	}
-	logger.Debugf("[%s] Received offer for bike %s at price: '%.2f'",
-		shortID(pr.Node.ID()), shortID(bikeID), price)
-	var rID string
-	if price > pr.maxPrice {
-		logger.Debugf("[%s] Rejected offer for price '%.2f'",
-			shortID(pr.Node.ID()), price)
-		rID = "reject"
-		pr.rentalRequests[j.Key()] <- ""
-	} else {
-		logger.Debugf("[%s] Accepted offer for price '%.2f'",
-			shortID(pr.Node.ID()), price)
-		rID = "accept"
-		pr.rentalRequests[j.Key()] <- bikeID
-	}
-	i.Update(j)
-	i.SetValue("rID", rID)
-	go sendEvent(events.MakeUpdateEvent(i), i, pr.Node)
 	return nil
 }
 
-func (pr *personReasoner) bikeRental(origin, destination string, result chan string, errc chan error) string {
-	protocol := bikeRentalProtocol
-	key := protocol.Key()
-	renters := pr.Node.FindContact(key, "Renter")
-	if len(renters) == 0 {
-		errc <- errors.New("No renters found")
-		return ""
+// findStation of a renter near c to pick up or drop off a bike, as the
+// person prefers, searched with the locator of the person or else
+// asking the renter
+func (pr *personReasoner) findStation(renter peer.ID, c Coords, intent string) (stationInfo, error) {
+	pr.mutex.Lock()
+	preference := pr.stationPreference
+	locator := pr.locator
+	pr.mutex.Unlock()
+	if locator == "" {
+		locator = renter
 	}
-	id := renters[0]
-	roles := bspl.Roles{"Client": pr.Node.ID().Pretty(), "Renter": id.Pretty()}
-	inputs := bspl.Values{"in origin": origin, "in destination": destination}
-	instance, err := pr.Instantiate(protocol, roles, inputs)
+	candidates, err := pr.stationSearch(locator, c, intent, preference.Candidates, renter.Pretty())
 	if err != nil {
-		errc <- err
-		return ""
-	}
-	pr.Node.OpenInstances[instance.Key()] = id
-	event := events.MakeNewEvent(instance)
-	logger.Infof("[%s] Sent rent request to %s", shortID(pr.Node.ID()), shortID(id))
-	// send event without blocking execution
-	okChan, errChan := sendEventWithResults(pr.Node, id, event)
-	select {
-	case err := <-errChan:
-		errc <- err
-		return ""
-	case ok := <-okChan:
-		if !ok {
-			errc <- fmt.Errorf("Instance already existed in renter node")
-		}
+		return stationInfo{}, err
 	}
-	pr.rentalRequests[instance.Key()] = result
-	return instance.GetValue("ID")
+	candidate, found := preference.choose(candidates, intent)
+	if !found {
+		return stationInfo{}, fmt.Errorf("None of the %d stations found for %s is within reach", len(candidates), intent)
+	}
+	return candidate.station, nil
 }
 
-func (pr *personReasoner) stationSearch(c Coords, result chan string, errc chan error) {
-	protocol := stationSearchProtocol
-	key := protocol.Key()
-	locators := pr.Node.FindContact(key, "Locator")
-	if len(locators) == 0 {
-		errc <- errors.New("No locators found")
-		return
+// stationSearch asks a locator for up to limit stations of an operator,
+// or of anyOperator, near c that can serve an intent, nearest first
+func (pr *personReasoner) stationSearch(locator peer.ID, c Coords, intent string, limit int, operator string) ([]stationCandidate, error) {
+	roles := bspl.Roles{"User": pr.Node.ID().Pretty(), "Locator": locator.Pretty()}
+	inputs := bspl.Values{
+		"in coordinates": c.String(),
+		"in intent":      intent,
+		"in limit":       strconv.Itoa(limit),
+		"in operator":    operator,
 	}
-	id := locators[0]
-	roles := bspl.Roles{"User": pr.Node.ID().Pretty(), "Locator": id.Pretty()}
-	inputs := bspl.Values{"in coordinates": c.String()}
-	instance, err := pr.Instantiate(protocol, roles, inputs)
+	instance, err := pr.Instantiate(stationSearchProtocol, roles, inputs)
 	if err != nil {
-		errc <- err
-		return
+		return nil, err
 	}
-	pr.Node.OpenInstances[instance.Key()] = id
-	event := events.MakeNewEvent(instance)
-	// send event without blocking execution
-	okChan, errChan := sendEventWithResults(pr.Node, id, event)
-	select {
-	case err := <-errChan:
-		errc <- err
-		return
-	case ok := <-okChan:
-		if !ok {
-			errc <- fmt.Errorf("Instance already existed in renter node")
+	pr.Node.SetInstancePeer(instance.Key(), locator)
+	// the answer may arrive before the event is acknowledged
+	result := make(chan []stationCandidate, 1)
+	pr.mutex.Lock()
+	pr.stationSearches[instance.Key()] = result
+	pr.mutex.Unlock()
+	ok, err := pr.Node.SendEvent(locator, events.MakeNewEvent(instance))
+	if err == nil && !ok {
+		err = rejectedBy("Locator", locator, instance.Key())
+	}
+	if err == nil {
+		// wall time, as it bounds the time the messages take
+		select {
+		case candidates := <-result:
+			if len(candidates) == 0 {
+				return nil, fmt.Errorf("No station for %s found", intent)
+			}
+			return candidates, nil
+		case <-time.After(timeout):
+			err = errors.New("No answer from the locator")
 		}
 	}
-	pr.stationSearches[instance.Key()] = result
+	pr.mutex.Lock()
+	delete(pr.stationSearches, instance.Key())
+	pr.mutex.Unlock()
+	return nil, err
 }
 
 func (pr *personReasoner) pickBike(bikeID, rentalID string) {
@@ -386,18 +637,25 @@ func (pr *personReasoner) pickBike(bikeID, rentalID string) {
 	roles := bspl.Roles{"Rider": pr.Node.ID().Pretty(), "Bike": bikeID}
 	inputs := bspl.Values{"in rentalID": rentalID}
 	i, _ := pr.Instantiate(bikeRideProtocol, roles, inputs)
-	pr.Node.OpenInstances[i.Key()], _ = peer.IDB58Decode(bikeID)
+	bike, _ := peer.IDB58Decode(bikeID)
+	pr.Node.SetInstancePeer(i.Key(), bike)
 	go sendEvent(events.MakeNewEvent(i), i, pr.Node)
+	pr.mutex.Lock()
 	pr.currentBikeRide = i.Key()
+	pr.mutex.Unlock()
 }
 
 func (pr *personReasoner) dropBike(stationID string) {
-	i, found := pr.openInstances[pr.currentBikeRide]
+	pr.mutex.Lock()
+	key := pr.currentBikeRide
+	pr.currentBikeRide = ""
+	pr.mutex.Unlock()
+	i, found := pr.GetInstance(key)
 	if !found {
-		logger.Errorf("[%s] Instance with key '%s' not found", shortID(pr.Node.ID()), i.Key())
+		logger.Errorf("[%s] Instance with key '%s' not found", shortID(pr.Node.ID()), key)
 		return
 	}
-	pr.currentBikeRide = ""
 	i.SetValue("dropStation", stationID)
 	go sendEvent((events.MakeUpdateEvent(i)), i, pr.Node)
+	pr.complete(i.Key())
 }
@@ -0,0 +1,80 @@
+package v2
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// people travelling at once send events that the renter and the
+// stations handle concurrently. Two people are enough to race, more of
+// them make the race detector catch it reliably.
+func TestPerson_concurrentTravel(t *testing.T) {
+	const n = 6
+	s := Scenario{
+		Stations: []StationSpec{
+			{Name: "s1", Coords: Coords{Lat: 0, Lon: 0}, Bikes: n},
+			{Name: "s2", Coords: Coords{Lat: 0.001, Lon: 0.001}},
+		},
+		Renters: []RenterSpec{{Name: "r", Stations: []string{"s1", "s2"}}},
+	}
+	for i := 0; i < n; i++ {
+		s.People = append(s.People, PersonSpec{Name: fmt.Sprintf("p%d", i)})
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for _, p := range w.People {
+		wg.Add(1)
+		go func(p Person) {
+			defer wg.Done()
+			errs <- p.Travel(s.Stations[0].Coords, s.Stations[1].Coords)
+		}(p)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if rentals := w.Renters["r"].reasoner.InstancesIn(bikeRentalProtocol, demo.InstanceCompleted); len(rentals) != n {
+		t.Errorf("Expected %d rentals, got %d", n, len(rentals))
+	}
+}
+
+// the renter concedes half of the price at once, the person accepts
+// at most 0.2 and bids 0.1 first
+func TestPerson_negotiatedRental(t *testing.T) {
+	s := Scenario{
+		Stations: []StationSpec{
+			{Name: "s1", Coords: Coords{Lat: 0, Lon: 0}, Bikes: 1},
+			{Name: "s2", Coords: Coords{Lat: 0.001, Lon: 0.001}},
+		},
+		Renters: []RenterSpec{{
+			Name: "r", Stations: []string{"s1", "s2"},
+			Pricing:     &PricingSpec{Strategy: "flat", Price: 0.2},
+			Negotiation: &SellerStrategy{Discount: 0.5, Concession: 1, Rounds: 1},
+		}},
+		People: []PersonSpec{{Name: "p", Negotiation: &BuyerStrategy{Reservation: 0.2, Opening: 0.1, Rounds: 1}}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.People["p"].Travel(s.Stations[0].Coords, s.Stations[1].Coords); err != nil {
+		t.Fatal(err)
+	}
+	rentals := w.Renters["r"].reasoner.InstancesIn(bikeRentalProtocol, demo.InstanceCompleted)
+	if len(rentals) != 1 {
+		t.Fatalf("Expected a rental, got %d", len(rentals))
+	}
+	if price, agreed := rentals[0].GetValue("price"), rentals[0].GetValue("agreed"); price != "0.2" || agreed != "0.1" {
+		t.Errorf("Expected the rental offered at 0.2 and agreed at 0.1, got %s and %s", price, agreed)
+	}
+}
@@ -0,0 +1,229 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// PriceQuery holds what a renter knows when pricing a rental
+type PriceQuery struct {
+	// Time of the request
+	Time time.Time
+	// Origin are the coordinates of the station the bike is taken from
+	Origin Coords
+	// Destination of the client, if HasDestination
+	Destination    Coords
+	HasDestination bool
+	// Distance between the origin and the destination, if
+	// HasDestination, as measured by the renter
+	Distance float64
+	// Available bikes left at the origin station
+	Available int
+	// Random source of the renter
+	Random *rand.Rand
+}
+
+// PricingStrategy prices the rentals of a renter. Renters don't call
+// it concurrently.
+type PricingStrategy interface {
+	Price(q PriceQuery) float64
+}
+
+// FlatPricing charges the same price for every rental
+type FlatPricing struct {
+	Amount float64
+}
+
+// Price of a rental
+func (p FlatPricing) Price(q PriceQuery) float64 {
+	return p.Amount
+}
+
+// RandomPricing charges one of the given prices at random
+type RandomPricing struct {
+	Prices []float64
+}
+
+// Price of a rental
+func (p RandomPricing) Price(q PriceQuery) float64 {
+	return p.Prices[q.Random.Intn(len(p.Prices))]
+}
+
+// TimeOfDayPricing multiplies a base price during peak hours
+type TimeOfDayPricing struct {
+	Base float64
+	Peak float64
+	// PeakHours are [from, to) hour ranges, e.g. {7, 9}
+	PeakHours [][2]int
+}
+
+// Price of a rental
+func (p TimeOfDayPricing) Price(q PriceQuery) float64 {
+	hour := q.Time.Hour()
+	for _, h := range p.PeakHours {
+		if hour >= h[0] && hour < h[1] {
+			return p.Base * p.Peak
+		}
+	}
+	return p.Base
+}
+
+// DemandPricing raises a base price as the bikes left at the origin
+// station fall below a target, by up to Factor times the base price
+type DemandPricing struct {
+	Base   float64
+	Factor float64
+	Target int
+}
+
+// Price of a rental
+func (p DemandPricing) Price(q PriceQuery) float64 {
+	if p.Target <= 0 || q.Available >= p.Target {
+		return p.Base
+	}
+	shortage := float64(p.Target-q.Available) / float64(p.Target)
+	return p.Base * (1 + p.Factor*shortage)
+}
+
+// DistancePricing charges a base price plus a price per meter between
+// the origin and the destination
+type DistancePricing struct {
+	Base    float64
+	PerUnit float64
+}
+
+// Price of a rental
+func (p DistancePricing) Price(q PriceQuery) float64 {
+	if !q.HasDestination {
+		return p.Base
+	}
+	return p.Base + p.PerUnit*q.Distance
+}
+
+// SurgePricing multiplies the price of another strategy while the
+// requests in a time window exceed a threshold
+type SurgePricing struct {
+	Strategy   PricingStrategy
+	Window     time.Duration
+	Threshold  int
+	Multiplier float64
+
+	requests []time.Time
+}
+
+// Price of a rental
+func (p *SurgePricing) Price(q PriceQuery) float64 {
+	recent := p.requests[:0]
+	for _, t := range p.requests {
+		if q.Time.Sub(t) < p.Window {
+			recent = append(recent, t)
+		}
+	}
+	p.requests = append(recent, q.Time)
+	price := p.Strategy.Price(q)
+	if len(p.requests) > p.Threshold {
+		return price * p.Multiplier
+	}
+	return price
+}
+
+// roundPrice avoids offering prices such as 0.030000000000000002
+func roundPrice(price float64) float64 {
+	return math.Round(price*1e4) / 1e4
+}
+
+// formatPrice returns the value of a price parameter
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(roundPrice(price), 'f', -1, 64)
+}
+
+// defaultPricing is the strategy of the renters unless configured
+var defaultPricing = RandomPricing{Prices: []float64{0.01, 0.02, 0.03}}
+
+// PricingSpec configures a pricing strategy, see the fields of each
+// strategy for the meaning of the parameters
+type PricingSpec struct {
+	// Strategy is one of flat, random, time_of_day, demand, distance
+	// and surge
+	Strategy string `json:"strategy"`
+	// Price is the flat price or the base price of the other strategies
+	Price     float64   `json:"price"`
+	Prices    []float64 `json:"prices"`
+	Peak      float64   `json:"peak"`
+	PeakHours [][2]int  `json:"peakHours"`
+	Factor    float64   `json:"factor"`
+	Target    int       `json:"target"`
+	PerUnit   float64   `json:"perUnit"`
+	// Base is the strategy surge pricing is applied to
+	Base       *PricingSpec `json:"base"`
+	Window     string       `json:"window"`
+	Threshold  int          `json:"threshold"`
+	Multiplier float64      `json:"multiplier"`
+}
+
+// Validate the parameters of the spec, but not the ones of its base
+// strategy
+func (s PricingSpec) Validate() error {
+	if s.Price < 0 || s.Peak < 0 || s.Factor < 0 || s.PerUnit < 0 || s.Multiplier < 0 {
+		return errors.New("Prices, factors and multipliers can't be negative")
+	}
+	if s.Target < 0 || s.Threshold < 0 {
+		return errors.New("Targets and thresholds can't be negative")
+	}
+	for _, price := range s.Prices {
+		if price < 0 {
+			return fmt.Errorf("Negative price: %g", price)
+		}
+	}
+	if s.Strategy == "surge" && s.Multiplier < 1 {
+		return fmt.Errorf("Surge multiplier must be at least 1: %g", s.Multiplier)
+	}
+	if s.Strategy == "random" && len(s.Prices) == 0 {
+		return errors.New("Missing prices for random pricing")
+	}
+	for _, h := range s.PeakHours {
+		if h[0] < 0 || h[1] > 24 || h[0] >= h[1] {
+			return fmt.Errorf("Invalid peak hours: %v", h)
+		}
+	}
+	return nil
+}
+
+// NewStrategy builds the pricing strategy described by the spec
+func (s PricingSpec) NewStrategy() (PricingStrategy, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	switch s.Strategy {
+	case "flat":
+		return FlatPricing{Amount: s.Price}, nil
+	case "random":
+		return RandomPricing{Prices: s.Prices}, nil
+	case "time_of_day":
+		return TimeOfDayPricing{Base: s.Price, Peak: s.Peak, PeakHours: s.PeakHours}, nil
+	case "demand":
+		return DemandPricing{Base: s.Price, Factor: s.Factor, Target: s.Target}, nil
+	case "distance":
+		return DistancePricing{Base: s.Price, PerUnit: s.PerUnit}, nil
+	case "surge":
+		if s.Base == nil {
+			return nil, fmt.Errorf("Missing base strategy for surge pricing")
+		}
+		base, err := s.Base.NewStrategy()
+		if err != nil {
+			return nil, err
+		}
+		window, err := time.ParseDuration(s.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("Invalid surge window: '%s'", s.Window)
+		}
+		return &SurgePricing{
+			Strategy: base, Window: window, Threshold: s.Threshold, Multiplier: s.Multiplier,
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown pricing strategy '%s'", s.Strategy)
+}
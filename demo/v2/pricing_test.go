@@ -0,0 +1,96 @@
+package v2
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPricingStrategies(t *testing.T) {
+	morning := time.Date(2020, 6, 18, 8, 0, 0, 0, time.UTC)
+	night := time.Date(2020, 6, 18, 23, 0, 0, 0, time.UTC)
+	q := PriceQuery{
+		Time:           morning,
+		Origin:         Coords{Lat: 0, Lon: 0},
+		Destination:    Coords{Lat: 0.00004, Lon: 0.00003},
+		HasDestination: true,
+		Distance:       5,
+		Available:      1,
+		Random:         rand.New(rand.NewSource(1)),
+	}
+	peak := TimeOfDayPricing{Base: 0.02, Peak: 2, PeakHours: [][2]int{{7, 9}}}
+	offPeak := q
+	offPeak.Time = night
+	tests := []struct {
+		name     string
+		strategy PricingStrategy
+		q        PriceQuery
+		expected float64
+	}{
+		{"flat", FlatPricing{Amount: 0.02}, q, 0.02},
+		{"random", RandomPricing{Prices: []float64{0.03}}, q, 0.03},
+		{"peak", peak, q, 0.04},
+		{"off-peak", peak, offPeak, 0.02},
+		{"demand", DemandPricing{Base: 0.02, Factor: 1, Target: 2}, q, 0.03},
+		{"distance", DistancePricing{Base: 0.01, PerUnit: 0.002}, q, 0.02},
+	}
+	for _, test := range tests {
+		if price := test.strategy.Price(test.q); math.Abs(price-test.expected) > 1e-9 {
+			t.Errorf("%s: expected %f, got %f", test.name, test.expected, price)
+		}
+	}
+}
+
+func TestSurgePricing(t *testing.T) {
+	start := time.Date(2020, 6, 18, 8, 0, 0, 0, time.UTC)
+	surge := &SurgePricing{
+		Strategy:   FlatPricing{Amount: 0.01},
+		Window:     time.Minute,
+		Threshold:  2,
+		Multiplier: 3,
+	}
+	expected := []float64{0.01, 0.01, 0.03}
+	for i, e := range expected {
+		q := PriceQuery{Time: start.Add(time.Duration(i) * time.Second)}
+		if price := surge.Price(q); math.Abs(price-e) > 1e-9 {
+			t.Errorf("Request %d: expected %f, got %f", i, e, price)
+		}
+	}
+	// requests out of the window are forgotten
+	if price := surge.Price(PriceQuery{Time: start.Add(time.Hour)}); math.Abs(price-0.01) > 1e-9 {
+		t.Errorf("Expected %f, got %f", 0.01, price)
+	}
+}
+
+func TestPricingSpec_NewStrategy(t *testing.T) {
+	valid := PricingSpec{
+		Strategy: "surge", Window: "1m", Threshold: 2, Multiplier: 2,
+		Base: &PricingSpec{Strategy: "distance", Price: 0.01, PerUnit: 0.001},
+	}
+	if _, err := valid.NewStrategy(); err != nil {
+		t.Error(err)
+	}
+	for _, invalid := range []PricingSpec{
+		{Strategy: "auction"},
+		{Strategy: "random"},
+		{Strategy: "surge", Window: "1m", Multiplier: 2},
+		{Strategy: "time_of_day", PeakHours: [][2]int{{9, 7}}},
+		{Strategy: "random", Prices: []float64{}},
+		{Strategy: "random", Prices: []float64{0.01, -0.01}},
+		{Strategy: "flat", Price: -1},
+		{Strategy: "demand", Price: 0.01, Factor: -1},
+		{Strategy: "demand", Price: 0.01, Target: -1},
+		{Strategy: "distance", PerUnit: -0.001},
+		{Strategy: "surge", Window: "1m", Threshold: -1, Multiplier: 2, Base: &PricingSpec{Strategy: "flat"}},
+		{Strategy: "surge", Window: "1m", Multiplier: -2, Base: &PricingSpec{Strategy: "flat"}},
+		{Strategy: "surge", Window: "1m", Base: &PricingSpec{Strategy: "flat"}},
+		{Strategy: "surge", Window: "1m", Multiplier: 0.5, Base: &PricingSpec{Strategy: "flat"}},
+		{Strategy: "surge", Window: "1m", Multiplier: 2, Base: &PricingSpec{Strategy: "flat", Price: -1}},
+		{Strategy: "surge", Window: "-1m", Multiplier: 2, Base: &PricingSpec{Strategy: "flat"}},
+	} {
+		if _, err := invalid.NewStrategy(); err == nil {
+			t.Errorf("Invalid spec accepted: %+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package v2
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// agentRand returns the random source of an agent of a run given the
+// seed of the run and a name unique to the agent, so that the agent
+// draws the same numbers whatever other agents there are and the
+// order they are created in
+func agentRand(seed int64, name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
@@ -0,0 +1,20 @@
+package v2
+
+import (
+	"testing"
+)
+
+func TestAgentRand(t *testing.T) {
+	draw := func(seed int64, name string) int64 {
+		return agentRand(seed, name).Int63()
+	}
+	if draw(42, "renter/r1") != draw(42, "renter/r1") {
+		t.Error("The same agent drew different numbers")
+	}
+	if draw(42, "renter/r1") == draw(42, "renter/r2") {
+		t.Error("Agents share the same random source")
+	}
+	if draw(42, "renter/r1") == draw(43, "renter/r1") {
+		t.Error("Runs with different seeds share the same random source")
+	}
+}
@@ -0,0 +1,257 @@
+package v2
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/events"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+type (
+	// instantiateHandler creates a new instance of a consumed protocol
+	instantiateHandler func(roles bspl.Roles, values bspl.Values) (bspl.Instance, error)
+	// registerHandler reacts to a new instance of an offered protocol
+	registerHandler func(i bspl.Instance) error
+	// updateHandler reacts to the actions run on an instance before
+	// the stored version of the instance is updated
+	updateHandler func(j bspl.Instance, actions []bspl.Action) error
+	// dropHandler reacts to an open instance being dropped
+	dropHandler func(i bspl.Instance, motive string)
+)
+
+// baseReasoner implements the bspl.Reasoner logic shared by every agent.
+// Agents embed it and plug in the handlers of the protocols they offer
+// and consume.
+type baseReasoner struct {
+	Node *nahs.Node
+	// mutex guards the state of the agent embedding the reasoner,
+	// as events are handled concurrently
+	mutex sync.Mutex
+	// clock the agent tells the time with
+	clock Clock
+	// distances the agent measures with
+	distances DistanceProvider
+	// random source of the agent, guarded by mutex
+	random *rand.Rand
+
+	offeredServices  map[string]bspl.Protocol
+	consumedServices map[string]bspl.Protocol
+	instances        *demo.InstanceStore
+
+	instantiateHandlers map[string]instantiateHandler
+	registerHandlers    map[string]registerHandler
+	updateHandlers      map[string]updateHandler
+	dropHandlers        map[string]dropHandler
+}
+
+// AgentOptions are what the constructors of the agents take besides
+// the parameters of each agent
+type AgentOptions struct {
+	// Clock the agent tells the time with, the wall clock if nil
+	Clock Clock
+	// Distances the agent measures with, haversine ones if nil
+	Distances DistanceProvider
+	// Random source of the agent, seeded from the wall clock if nil
+	Random *rand.Rand
+}
+
+func newBaseReasoner(o AgentOptions) baseReasoner {
+	clock := o.Clock
+	if clock == nil {
+		clock = WallClock{}
+	}
+	distances := o.Distances
+	if distances == nil {
+		distances = Haversine{}
+	}
+	random := o.Random
+	if random == nil {
+		random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return baseReasoner{
+		clock:               clock,
+		distances:           distances,
+		random:              random,
+		offeredServices:     make(map[string]bspl.Protocol),
+		consumedServices:    make(map[string]bspl.Protocol),
+		instances:           demo.NewInstanceStore(),
+		instantiateHandlers: make(map[string]instantiateHandler),
+		registerHandlers:    make(map[string]registerHandler),
+		updateHandlers:      make(map[string]updateHandler),
+		dropHandlers:        make(map[string]dropHandler),
+	}
+}
+
+// offer a protocol. The handlers are run when another agent creates
+// or updates an instance of the protocol, nil handlers are ignored.
+func (b *baseReasoner) offer(p bspl.Protocol, register registerHandler, update updateHandler) {
+	b.offeredServices[p.Key()] = p
+	if register != nil {
+		b.registerHandlers[p.Key()] = register
+	}
+	if update != nil {
+		b.updateHandlers[p.Key()] = update
+	}
+}
+
+// consume a protocol. The instantiate handler creates the instances of
+// the protocol and the update handler is run when another agent updates
+// them, a nil update handler is ignored.
+func (b *baseReasoner) consume(p bspl.Protocol, instantiate instantiateHandler, update updateHandler) {
+	b.consumedServices[p.Key()] = p
+	b.instantiateHandlers[p.Key()] = instantiate
+	if update != nil {
+		b.updateHandlers[p.Key()] = update
+	}
+}
+
+// onDrop sets the handler run when an open instance of a protocol is
+// dropped, either by the agent or by the agent it is enacted with
+func (b *baseReasoner) onDrop(p bspl.Protocol, drop dropHandler) {
+	b.dropHandlers[p.Key()] = drop
+}
+
+// DropInstance cancels an Instance for whatever motive
+func (b *baseReasoner) DropInstance(instanceKey string, motive string) error {
+	i, found := b.instances.Get(instanceKey)
+	if err := b.instances.Drop(instanceKey); err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	if drop, found := b.dropHandlers[i.Protocol().Key()]; found {
+		drop(i, motive)
+	}
+	return nil
+}
+
+// reject an instance with a malformed or invalid value: it is dropped
+// and the agent it is enacted with is told why
+func (b *baseReasoner) reject(i bspl.Instance, err error) error {
+	b.DropInstance(i.Key(), err.Error())
+	go sendEvent(events.MakeDropEvent(i.Key(), err.Error()), i, b.Node)
+	return err
+}
+
+// GetInstance returns an Instance given the instance key
+func (b *baseReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
+	return b.instances.Get(instanceKey)
+}
+
+// Instances returns the open instances of a Protocol
+func (b *baseReasoner) Instances(p bspl.Protocol) []bspl.Instance {
+	return b.instances.Instances(p.Key())
+}
+
+// InstancesIn returns the instances of a Protocol in any of the given
+// states, or the open ones if no state is given
+func (b *baseReasoner) InstancesIn(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return b.instances.Instances(p.Key(), states...)
+}
+
+// complete marks an instance as completed once the last action
+// of its protocol has been run
+func (b *baseReasoner) complete(instanceKey string) {
+	if err := b.instances.Complete(instanceKey); err != nil {
+		logger.Errorf("[%s] %s", shortID(b.Node.ID()), err)
+	}
+}
+
+// Instantiate a protocol. Check if the assigned role is a role
+// the reasoner is willing to play.
+func (b *baseReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
+	if _, consumed := b.consumedServices[p.Key()]; !consumed {
+		return nil, fmt.Errorf("Protocol '%s' not supported by this Node", p.Key())
+	}
+	instantiate, found := b.instantiateHandlers[p.Key()]
+	if !found {
+		return nil, fmt.Errorf("Unkown protocol '%s'", p.Key())
+	}
+	i, err := instantiate(roles, ins)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkValues(i); err != nil {
+		return nil, err
+	}
+	if err := b.instances.Add(i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// RegisterInstance registers an Instance created by another Reasoner
+func (b *baseReasoner) RegisterInstance(i bspl.Instance) error {
+	if _, found := b.instances.Get(i.Key()); found {
+		return fmt.Errorf("Instance '%s' already existed", i.Key())
+	}
+	// TODO: verify who sends the message and assert the role ID is correct.
+	// This should be done in the library, not the demo.
+	if len(i.Roles()) < 2 {
+		return fmt.Errorf("Missing roles for instance '%s'", i.Key())
+	}
+	if _, offered := b.offeredServices[i.Protocol().Key()]; !offered {
+		return fmt.Errorf("Protocol '%s' not offered", i.Protocol().Key())
+	}
+	if err := b.instances.Add(i); err != nil {
+		return err
+	}
+	if err := checkValues(i); err != nil {
+		logger.Errorf("[%s] %s", shortID(b.Node.ID()), err)
+		return b.reject(i, err)
+	}
+	register, found := b.registerHandlers[i.Protocol().Key()]
+	if !found {
+		return nil
+	}
+	err := register(i)
+	if err != nil {
+		logger.Errorf("[%s] %s", shortID(b.Node.ID()), err)
+	}
+	return err
+}
+
+// UpdateInstance updates an instance with a newer version of itself
+// as long as a valid run from one to the other.
+func (b *baseReasoner) UpdateInstance(j bspl.Instance) error {
+	i, found := b.instances.Get(j.Key())
+	if !found {
+		return fmt.Errorf("Instance '%s' not found", j.Key())
+	}
+	update, found := b.updateHandlers[j.Protocol().Key()]
+	if !found {
+		return fmt.Errorf("Unkown protocol in update: %s", j.Protocol().Key())
+	}
+	actions, _, err := i.Diff(j)
+	if err != nil {
+		return err
+	}
+	if err := checkValues(j); err != nil {
+		return b.reject(i, err)
+	}
+	if err := update(j, actions); err != nil {
+		return err
+	}
+	return i.Update(j)
+}
+
+// requireValues checks that every required input is present in values
+// and returns them
+func requireValues(values bspl.Values, required ...string) (bspl.Values, error) {
+	params := make(bspl.Values)
+	for _, r := range required {
+		v, found := values[r]
+		if !found {
+			return nil, fmt.Errorf("Missing parameter: '%s'", r)
+		}
+		params[r] = v
+	}
+	return params, nil
+}
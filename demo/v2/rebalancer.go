@@ -0,0 +1,370 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// goals of a rebalancer
+const (
+	// rebalanceShortages fills the stations predicted to run low
+	rebalanceShortages = "shortages"
+	// rebalanceEven evens out the bikes of every station
+	rebalanceEven = "even"
+)
+
+// RebalancePolicy is when and how a rebalancer moves bikes between
+// the stations it watches
+type RebalancePolicy struct {
+	Goal string
+	// Low is the number of bikes under which a station runs short and
+	// High the number over which a station can give bikes away
+	Low  int
+	High int
+	// MaxMoves is the number of bikes moved each round at most,
+	// unlimited if 0
+	MaxMoves int
+	// Interval between rounds
+	Interval time.Duration
+	// Horizon is how far ahead shortages are predicted, and the time
+	// the bikes moved have to arrive in
+	Horizon time.Duration
+	// Window of the occupancy history the predictions are made from
+	Window time.Duration
+}
+
+// defaultRebalance keeps at least a bike at every station
+var defaultRebalance = RebalancePolicy{
+	Goal:     rebalanceShortages,
+	Low:      1,
+	High:     2,
+	Interval: 10 * time.Second,
+	Horizon:  30 * time.Second,
+	Window:   time.Minute,
+}
+
+// occupancy of a station at some time
+type occupancy struct {
+	at        time.Time
+	available int
+}
+
+// stationState is what a rebalancer knows about a station
+type stationState struct {
+	station   stationInfo
+	available int
+	// history of the occupancy of the station, oldest first
+	history []occupancy
+	// incoming are the bikes on their way to the station
+	incoming int
+	// docks are the free docks of the station, unlimitedDocks if it
+	// has no limit
+	docks int
+}
+
+// transfer of bikes between two stations
+type transfer struct {
+	src   stationInfo
+	dst   stationInfo
+	bikes int
+}
+
+// predict the bikes of a station once the horizon is over from the
+// net rentals of its history and the bikes on their way
+func (p RebalancePolicy) predict(s stationState, now time.Time) float64 {
+	predicted := float64(s.available + s.incoming)
+	if len(s.history) == 0 {
+		return predicted
+	}
+	oldest := s.history[0]
+	elapsed := now.Sub(oldest.at)
+	if elapsed <= 0 {
+		return predicted
+	}
+	rate := float64(s.available-oldest.available) / elapsed.Seconds()
+	return math.Max(0, predicted+rate*p.Horizon.Seconds())
+}
+
+// transfers that meet the goal of the policy, taking bikes from the
+// nearest stations first as measured by d, never from the ones with no
+// way to the station in need
+func (p RebalancePolicy) transfers(states []stationState, now time.Time, d DistanceProvider) []transfer {
+	needs := make(map[string]int)
+	surplus := make(map[string]int)
+	predicted := make(map[string]float64)
+	total := 0.0
+	for _, s := range states {
+		predicted[s.station.id] = p.predict(s, now)
+		total += predicted[s.station.id]
+	}
+	mean := total / float64(len(states))
+	for _, s := range states {
+		id := s.station.id
+		// the bikes predicted to be rented can't be given away
+		spare := math.Min(float64(s.available), predicted[id])
+		switch p.Goal {
+		case rebalanceEven:
+			needs[id] = int(math.Floor(mean - predicted[id]))
+			surplus[id] = int(math.Floor(spare - mean))
+		default:
+			needs[id] = int(math.Ceil(float64(p.Low) - predicted[id]))
+			surplus[id] = int(math.Floor(spare)) - p.High
+		}
+		// no more bikes than free docks, counting the ones on their way
+		if room := s.docks - s.incoming; s.docks != unlimitedDocks && needs[id] > room {
+			needs[id] = room
+		}
+	}
+
+	short := make([]stationState, 0)
+	for _, s := range states {
+		if needs[s.station.id] > 0 {
+			short = append(short, s)
+		}
+	}
+	sort.SliceStable(short, func(i, j int) bool { return needs[short[i].station.id] > needs[short[j].station.id] })
+	transfers := make([]transfer, 0)
+	moves := 0
+	for _, dst := range short {
+		donors := make([]stationState, 0)
+		for _, s := range states {
+			// a haul needs a way from the donor to the station
+			if surplus[s.station.id] > 0 && reachable(d.Distance(s.station.coords, dst.station.coords)) {
+				donors = append(donors, s)
+			}
+		}
+		sort.SliceStable(donors, func(i, j int) bool {
+			return d.Distance(dst.station.coords, donors[i].station.coords) <
+				d.Distance(dst.station.coords, donors[j].station.coords)
+		})
+		for _, src := range donors {
+			bikes := needs[dst.station.id]
+			if surplus[src.station.id] < bikes {
+				bikes = surplus[src.station.id]
+			}
+			if p.MaxMoves > 0 && moves+bikes > p.MaxMoves {
+				bikes = p.MaxMoves - moves
+			}
+			if bikes <= 0 {
+				break
+			}
+			transfers = append(transfers, transfer{src: src.station, dst: dst.station, bikes: bikes})
+			needs[dst.station.id] -= bikes
+			surplus[src.station.id] -= bikes
+			moves += bikes
+		}
+	}
+	return transfers
+}
+
+// RebalanceSpec configures a rebalance policy, the durations are
+// strings such as "10s"
+type RebalanceSpec struct {
+	// Goal is "shortages", to keep Low bikes at every station, or
+	// "even", to even out the bikes of the stations
+	Goal     string `json:"goal"`
+	Low      int    `json:"low"`
+	High     int    `json:"high"`
+	MaxMoves int    `json:"maxMoves"`
+	Interval string `json:"interval"`
+	Horizon  string `json:"horizon"`
+	Window   string `json:"window"`
+}
+
+// NewPolicy builds the rebalance policy described by the spec, with
+// the defaults for the values not set
+func (s RebalanceSpec) NewPolicy() (RebalancePolicy, error) {
+	p := defaultRebalance
+	switch s.Goal {
+	case "":
+	case rebalanceShortages, rebalanceEven:
+		p.Goal = s.Goal
+	default:
+		return p, fmt.Errorf("Unknown rebalance goal '%s'", s.Goal)
+	}
+	if s.Low != 0 || s.High != 0 {
+		p.Low, p.High = s.Low, s.High
+	}
+	if p.Low < 0 || p.High < p.Low || s.MaxMoves < 0 {
+		return p, errors.New("Invalid thresholds or moves")
+	}
+	p.MaxMoves = s.MaxMoves
+	durations := []struct {
+		value string
+		d     *time.Duration
+	}{{s.Interval, &p.Interval}, {s.Horizon, &p.Horizon}, {s.Window, &p.Window}}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return p, fmt.Errorf("Invalid duration: '%s'", d.value)
+		}
+		*d.d = parsed
+	}
+	return p, nil
+}
+
+// Rebalancer watches the occupancy of stations and requests transports
+// of bikes from the stations that can spare them to the ones running
+// short
+type Rebalancer struct {
+	reasoner *rebalancerReasoner
+	Node     *nahs.Node
+}
+
+// NewRebalancer is the default constructor for Rebalancer, given the
+// IDs of the stations it watches
+func NewRebalancer(o AgentOptions, stations ...string) Rebalancer {
+	r := Rebalancer{}
+	// the cycle of life
+	r.reasoner = newRebalancerReasoner(o, stations...)
+	r.Node = net.LocalNode(r.reasoner, NodeOptions...)
+	r.reasoner.Node = r.Node
+	logger.Debugf("\tCreated rebalancer with ID %s (%s)", shortID(r.ID()), r.ID())
+	return r
+}
+
+// ID of the rebalancer
+func (r Rebalancer) ID() string {
+	return r.Node.ID().Pretty()
+}
+
+// Instances of a protocol enacted by the rebalancer in any of the given
+// states, or the open ones if no state is given
+func (r Rebalancer) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return r.reasoner.InstancesIn(p, states...)
+}
+
+// SetPolicy sets when and how the rebalancer moves bikes
+func (r Rebalancer) SetPolicy(policy RebalancePolicy) {
+	r.reasoner.mutex.Lock()
+	defer r.reasoner.mutex.Unlock()
+	r.reasoner.policy = policy
+}
+
+// Rebalance the stations once, returns the number of bikes the
+// transports accepted to move
+func (r Rebalancer) Rebalance() int {
+	return r.reasoner.rebalance()
+}
+
+// Run rounds of rebalancing until stopped
+func (r Rebalancer) Run(stop <-chan struct{}) {
+	for {
+		r.reasoner.mutex.Lock()
+		interval := r.reasoner.policy.Interval
+		r.reasoner.mutex.Unlock()
+		r.Rebalance()
+		select {
+		case <-r.reasoner.clock.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+type rebalancerReasoner struct {
+	baseReasoner
+
+	inventory  *inventoryClient
+	transports *transportClient
+
+	stations []string
+	// policy, history of each station and bikes on their way to it,
+	// guarded by mutex
+	policy   RebalancePolicy
+	history  map[string][]occupancy
+	incoming map[string]int
+}
+
+func newRebalancerReasoner(o AgentOptions, stations ...string) *rebalancerReasoner {
+	r := &rebalancerReasoner{baseReasoner: newBaseReasoner(o)}
+	// watch the inventory of the stations and move bikes between them
+	r.inventory = newInventoryClient(&r.baseReasoner)
+	r.transports = newTransportClient(&r.baseReasoner, r.inventory)
+	r.stations = stations
+	r.policy = defaultRebalance
+	r.history = make(map[string][]occupancy)
+	r.incoming = make(map[string]int)
+	return r
+}
+
+// rebalance queries the stations and requests the transfers the policy
+// asks for, returns the number of bikes the transports accepted to move
+func (rr *rebalancerReasoner) rebalance() int {
+	now := rr.clock.Now()
+	rr.mutex.Lock()
+	policy := rr.policy
+	rr.mutex.Unlock()
+
+	states := make([]stationState, 0, len(rr.stations))
+	for _, id := range rr.stations {
+		report, err := rr.inventory.query(id)
+		if err != nil {
+			logger.Errorf("[%s] %s", shortID(rr.Node.ID()), err)
+			continue
+		}
+		states = append(states, rr.observe(stationInfo{id: id, coords: report.coords}, report, now, policy.Window))
+	}
+	if len(states) == 0 {
+		return 0
+	}
+
+	moved := 0
+	for _, t := range policy.transfers(states, now, rr.distances) {
+		logger.Infof("[%s] Moving %d bikes from %s to %s", shortID(rr.Node.ID()),
+			t.bikes, shortID(t.src.id), shortID(t.dst.id))
+		job := &transportJob{
+			bikeNum: t.bikes, dst: t.dst.id, datetime: now.Add(policy.Horizon),
+			sources: []string{t.src.id}, done: rr.arrived,
+		}
+		rr.mutex.Lock()
+		rr.incoming[t.dst.id] += t.bikes
+		rr.mutex.Unlock()
+		if err := rr.transports.dispatch(job); err != nil {
+			logger.Errorf("[%s] Couldn't move bikes to %s: %s", shortID(rr.Node.ID()), shortID(t.dst.id), err)
+			rr.arrived(job, err.Error())
+			continue
+		}
+		moved += t.bikes
+	}
+	return moved
+}
+
+// observe the occupancy of a station, the history older than the
+// window is forgotten
+func (rr *rebalancerReasoner) observe(s stationInfo, report inventoryReport, now time.Time, window time.Duration) stationState {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	history := rr.history[s.id]
+	for len(history) > 0 && now.Sub(history[0].at) > window {
+		history = history[1:]
+	}
+	state := stationState{station: s, available: report.available, incoming: rr.incoming[s.id], docks: report.docks}
+	state.history = append([]occupancy(nil), history...)
+	rr.history[s.id] = append(history, occupancy{at: now, available: report.available})
+	return state
+}
+
+// arrived is called once the transport of a job is over, its bikes are
+// no longer on their way
+func (rr *rebalancerReasoner) arrived(job *transportJob, reason string) {
+	rr.mutex.Lock()
+	rr.incoming[job.dst] -= job.bikeNum
+	rr.mutex.Unlock()
+	if reason != "" {
+		logger.Errorf("[%s] Only %d of %d bikes arrived at %s: %s", shortID(rr.Node.ID()),
+			job.delivered, job.bikeNum, shortID(job.dst), reason)
+	}
+}
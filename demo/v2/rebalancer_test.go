@@ -0,0 +1,88 @@
+package v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebalancePolicy_predict(t *testing.T) {
+	now := time.Now()
+	p := RebalancePolicy{Horizon: time.Minute}
+	// two bikes rented in the last minute
+	s := stationState{
+		available: 4,
+		incoming:  1,
+		history:   []occupancy{{at: now.Add(-time.Minute), available: 6}},
+	}
+	if predicted := p.predict(s, now); predicted != 3 {
+		t.Errorf("Expected 3 bikes, got %f", predicted)
+	}
+	s.available = 1
+	if predicted := p.predict(s, now); predicted != 0 {
+		t.Errorf("Expected no bikes, got %f", predicted)
+	}
+}
+
+func TestRebalancePolicy_transfers(t *testing.T) {
+	now := time.Now()
+	empty := stationState{station: stationInfo{id: "empty", coords: Coords{Lat: 0, Lon: 0}}, docks: unlimitedDocks}
+	near := stationState{station: stationInfo{id: "near", coords: Coords{Lat: 0, Lon: 0.0001}}, available: 4, docks: unlimitedDocks}
+	far := stationState{station: stationInfo{id: "far", coords: Coords{Lat: 0, Lon: 0.001}}, available: 8, docks: unlimitedDocks}
+	states := []stationState{empty, near, far}
+
+	p := RebalancePolicy{Goal: rebalanceShortages, Low: 3, High: 2, Horizon: time.Minute}
+	transfers := p.transfers(states, now, Euclidean{})
+	// the near station gives away what it spares, the far one the rest
+	if len(transfers) != 2 ||
+		transfers[0].src.id != "near" || transfers[0].bikes != 2 ||
+		transfers[1].src.id != "far" || transfers[1].bikes != 1 {
+		t.Errorf("Unexpected transfers: %v", transfers)
+	}
+
+	p.MaxMoves = 2
+	if transfers := p.transfers(states, now, Euclidean{}); len(transfers) != 1 {
+		t.Errorf("Expected a single transfer, got %v", transfers)
+	}
+
+	// no more bikes than the free docks of the station
+	states[0].docks = 1
+	if transfers := p.transfers(states, now, Euclidean{}); len(transfers) != 1 || transfers[0].bikes != 1 {
+		t.Errorf("Expected a single bike moved, got %v", transfers)
+	}
+	states[0].docks = unlimitedDocks
+
+	// no way from the far station to the empty one
+	n := NewStreetNetwork()
+	n.AddStreet([]Coords{empty.station.coords, near.station.coords}, false)
+	n.AddStreet([]Coords{far.station.coords, {Lat: 0.001, Lon: 0.001}}, false)
+	p.MaxMoves = 0
+	if transfers := p.transfers(states, now, n); len(transfers) != 1 || transfers[0].src.id != "near" {
+		t.Errorf("Expected bikes only from the near station, got %v", transfers)
+	}
+
+	even := RebalancePolicy{Goal: rebalanceEven, Horizon: time.Minute}
+	transfers = even.transfers(states, now, Euclidean{})
+	if len(transfers) != 1 || transfers[0].src.id != "far" || transfers[0].bikes != 4 {
+		t.Errorf("Unexpected transfers: %v", transfers)
+	}
+}
+
+func TestRebalanceSpec_NewPolicy(t *testing.T) {
+	p, err := RebalanceSpec{Goal: "even", Interval: "1s"}.NewPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Goal != rebalanceEven || p.Interval != time.Second || p.Horizon != defaultRebalance.Horizon {
+		t.Errorf("Unexpected policy: %+v", p)
+	}
+	invalid := []RebalanceSpec{
+		{Goal: "chaos"},
+		{Low: 3, High: 1},
+		{Window: "soon"},
+	}
+	for _, s := range invalid {
+		if _, err := s.NewPolicy(); err == nil {
+			t.Errorf("Invalid spec accepted: %+v", s)
+		}
+	}
+}
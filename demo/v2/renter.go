@@ -3,18 +3,14 @@ package v2
 import (
 	"errors"
 	"fmt"
-	"math"
-	"math/rand"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/mikelsr/bspl"
-	imp "github.com/mikelsr/bspl/implementation"
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 // Renter of bikes, controls stations
@@ -23,13 +19,14 @@ type Renter struct {
 	Node     *nahs.Node
 }
 
-// NewRenter is the default constructor for Renter
-func NewRenter(stations ...*Station) Renter {
+// NewRenter is the default constructor for Renter, given the IDs
+// of the stations it controls
+func NewRenter(o AgentOptions, stations ...string) Renter {
 	r := Renter{}
 	// the cycle of life
-	r.reasoner = newRenterReasoner(stations...)
+	r.reasoner = newRenterReasoner(o, stations...)
 	//p.Node = nahs.NewNode(p.reasoner)
-	r.Node = net.LocalNode(r.reasoner)
+	r.Node = net.LocalNode(r.reasoner, NodeOptions...)
 	r.reasoner.Node = r.Node
 
 	logger.Debugf("\tCreated renter with ID %s (%s)", shortID(r.ID()), r.Node.ID())
@@ -41,379 +38,329 @@ func (r Renter) ID() string {
 	return r.Node.ID().Pretty()
 }
 
-type renterReasoner struct {
-	Node *nahs.Node
-
-	offeredServices  map[string]bspl.Protocol
-	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+// Instances of a protocol enacted by the renter in any of the given
+// states, or the open ones if no state is given
+func (r Renter) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return r.reasoner.InstancesIn(p, states...)
+}
 
-	stationSearchRequests map[string]chan string
-	transportRequests     map[string]chan string
+// SetPricing sets the strategy the renter prices bikes with
+func (r Renter) SetPricing(pricing PricingStrategy) {
+	r.reasoner.mutex.Lock()
+	defer r.reasoner.mutex.Unlock()
+	r.reasoner.pricing = pricing
+}
 
-	stations map[string]*Station
+// SetReservationTTL sets how long the bike offered for a rental is held
+// for the client, the rental is dropped if not accepted by then
+func (r Renter) SetReservationTTL(ttl time.Duration) {
+	r.reasoner.mutex.Lock()
+	defer r.reasoner.mutex.Unlock()
+	r.reasoner.reservationTTL = ttl
 }
 
-func newRenterReasoner(stations ...*Station) *renterReasoner {
-	r := &renterReasoner{}
-	// initialize maps
-	r.openInstances = make(map[string]bspl.Instance)
-	r.droppedInstances = make(map[string]bspl.Instance)
-	r.consumedServices = map[string]bspl.Protocol{
-		bikeTransportProtocol.Key(): bikeTransportProtocol,
-	}
-	// rent bike, ride bike, search for a near station
-	r.offeredServices = map[string]bspl.Protocol{
-		bikeRentalProtocol.Key():    bikeRentalProtocol,
-		bikeRequestProtocol.Key():   bikeRequestProtocol,
-		stationSearchProtocol.Key(): stationSearchProtocol,
-	}
-	r.stationSearchRequests = make(map[string]chan string)
-	r.transportRequests = make(map[string]chan string)
-	r.stations = make(map[string]*Station)
-	for _, s := range stations {
-		r.stations[s.ID()] = s
-	}
-	return r
+// SetNegotiation sets the strategy the renter answers counter-offers with
+func (r Renter) SetNegotiation(strategy SellerStrategy) {
+	r.reasoner.mutex.Lock()
+	defer r.reasoner.mutex.Unlock()
+	r.reasoner.negotiation = strategy
 }
 
-// DropInstance cancels an Instance for whatever motive
-func (rr *renterReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := rr.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
-	}
-	rr.droppedInstances[instanceKey] = instance
-	delete(rr.openInstances, instanceKey)
-	return nil
+type renterReasoner struct {
+	baseReasoner
+
+	inventory      *inventoryClient
+	transports     *transportClient
+	locator        *stationLocator
+	pricing        PricingStrategy
+	negotiation    SellerStrategy
+	reservationTTL time.Duration
+	// offers are the bikes offered for open rentals, by rental ID,
+	// guarded by mutex
+	offers map[string]*bikeOffer
+
+	stations []string
 }
 
-// GetInstance returns an Instance given the instance key
-func (rr *renterReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	instance, found := rr.openInstances[instanceKey]
-	return instance, found
+func newRenterReasoner(o AgentOptions, stations ...string) *renterReasoner {
+	r := &renterReasoner{baseReasoner: newBaseReasoner(o)}
+	// check and change the inventory of the stations
+	r.inventory = newInventoryClient(&r.baseReasoner)
+	// request bike transports
+	r.transports = newTransportClient(&r.baseReasoner, r.inventory)
+	// search for stations near the users
+	r.locator = newStationLocator(&r.baseReasoner, r.inventory, r.stationEntries)
+	// rent bike, request bikes
+	r.offer(bikeRentalProtocol, r.registerBikeRental, r.updateBikeRental)
+	r.onDrop(bikeRentalProtocol, r.dropBikeRental)
+	r.offer(bikeNegotiationProtocol, r.registerBikeNegotiation, nil)
+	r.offer(bikeRequestProtocol, r.registerBikeRequest, nil)
+	r.offers = make(map[string]*bikeOffer)
+	r.stations = stations
+	r.pricing = defaultPricing
+	r.negotiation = defaultSeller
+	r.reservationTTL = defaultReservationTTL
+	return r
 }
 
-// All instances of a Protocol
-func (rr *renterReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	instances := make([]bspl.Instance, len(rr.openInstances))
-	i := 0
-	for _, v := range rr.openInstances {
-		instances[i] = v
-		i++
-	}
-	return instances
+// bikeOffer is the bike reserved for a rental, the price offered and
+// the price agreed, the one the renter asks for after negotiating. The
+// client must accept the rental at the price agreed.
+type bikeOffer struct {
+	key     string
+	client  string
+	station string
+	bikeID  string
+	price   float64
+	agreed  float64
 }
 
-func (rr *renterReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
-	if _, consumed := rr.consumedServices[p.Key()]; !consumed {
-		return nil, fmt.Errorf("Protocol '%s' not supported by this Node", p.Key())
+// bind the offer to the price a rental was accepted at, which must be
+// the price agreed
+func (o *bikeOffer) bind(i bspl.Instance) error {
+	agreed, err := typed(i).Float("agreed")
+	if err != nil {
+		return err
 	}
-	switch p.Key() {
-	case bikeTransportProtocol.Key():
-		return rr.instantiateBikeTransport(roles, ins)
+	if formatPrice(agreed) != formatPrice(o.agreed) {
+		return fmt.Errorf("Rental accepted at '%s' instead of the price agreed '%s'",
+			formatPrice(agreed), formatPrice(o.agreed))
 	}
-	return nil, fmt.Errorf("Unkown protocol '%s'", p.Key())
+	return nil
 }
 
-func (rr *renterReasoner) instantiateBikeTransport(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
-	id := uuid.New().String()
-	params := make(map[string]string)
-	required := []string{"in bikeNum", "in src", "in dst", "in datetime"}
-	for _, r := range required {
-		v, found := values[r]
-		if !found {
-			return nil, fmt.Errorf("Missing parameter: '%s'", r)
+func (rr *renterReasoner) registerBikeRental(i bspl.Instance) error {
+	stationID := i.GetValue("origin")
+	if !rr.hasStation(stationID) {
+		return rr.reject(i, fmt.Errorf("Invalid or null origin station ID: '%s'", stationID))
+	}
+	rr.mutex.Lock()
+	ttl := rr.reservationTTL
+	rr.mutex.Unlock()
+	report, err := rr.inventory.reserve(stationID, ttl)
+	if err != nil {
+		return rr.reject(i, err)
+	}
+	q := PriceQuery{
+		Time:      rr.clock.Now(),
+		Origin:    report.coords,
+		Available: report.available,
+	}
+	if dst, err := typed(i).Coords("destination"); err == nil {
+		q.Destination = dst
+		q.HasDestination = true
+		q.Distance = rr.distances.Distance(report.coords, dst)
+		if !reachable(q.Distance) {
+			if err := rr.inventory.cancel(stationID, report.bikeID); err != nil {
+				logger.Errorf("[%s] %s", shortID(rr.Node.ID()), err)
+			}
+			return rr.reject(i, fmt.Errorf("No way from station %s to %s", stationID, dst))
 		}
-		params[r] = v
 	}
-	params["out ID key"] = id
-	i := imp.NewInstance(bikeTransportProtocol, roles)
-	i.SetValue("ID", id)
-	i.SetValue("dst", params["in dst"])
-	i.SetValue("src", params["in src"])
-	i.SetValue("datetime", params["in datetime"])
-	i.SetValue("bikeNum", params["in bikeNum"])
-	rr.openInstances[i.Key()] = i
-	return i, nil
+	price := rr.calculatePrice(q)
+	offer := &bikeOffer{
+		key:     i.Key(),
+		client:  i.Roles()["Client"],
+		station: stationID,
+		bikeID:  report.bikeID,
+		price:   price,
+		agreed:  price,
+	}
+	rr.mutex.Lock()
+	rr.offers[i.GetValue("ID")] = offer
+	rr.mutex.Unlock()
+	i.SetValue("price", formatPrice(price))
+	i.SetValue("bikeID", report.bikeID)
+	go sendEvent(events.MakeUpdateEvent(i), i, rr.Node)
+	go rr.expireOffer(i.GetValue("ID"), offer, ttl)
+	return nil
 }
 
-func (rr *renterReasoner) RegisterInstance(i bspl.Instance) error {
-	if _, found := rr.openInstances[i.Key()]; found {
-		return fmt.Errorf("Instance '%s' already existed", i.Key())
-	}
-	// TODO: verify who sends the message and assert the role ID is correct.
-	// This should be done in the library, not the demo.
-	if len(i.Roles()) < 2 {
-		return fmt.Errorf("Missing roles for instance '%s'", i.Key())
-	}
-	found := false
-	for _, proto := range rr.offeredServices {
-		if proto.Key() == i.Protocol().Key() {
-			found = true
-		}
+// expireOffer drops a rental if the client doesn't accept
+// the offer before the TTL of the reservation is over
+func (rr *renterReasoner) expireOffer(rentalID string, offer *bikeOffer, ttl time.Duration) {
+	<-rr.clock.After(ttl)
+	rr.mutex.Lock()
+	expired := rr.offers[rentalID] == offer
+	rr.mutex.Unlock()
+	if !expired {
+		return
 	}
+	i, found := rr.GetInstance(offer.key)
 	if !found {
-		return fmt.Errorf("Protocol '%s' not offered", i.Protocol().Key())
+		return
 	}
-	rr.openInstances[i.Key()] = i
+	motive := "Offer expired"
+	logger.Infof("[%s] Offer of bike %s expired", shortID(rr.Node.ID()), shortID(offer.bikeID))
+	go sendEvent(events.MakeDropEvent(i.Key(), motive), i, rr.Node)
+	// the reservation is cancelled by the drop handler
+	rr.DropInstance(i.Key(), motive)
+}
 
-	var err error
-	switch i.Protocol().Key() {
-	case bikeRentalProtocol.Key():
-		err = rr.registerBikeRental(i)
-	case bikeRequestProtocol.Key():
-		err = rr.registerBikeRequest(i)
-	case stationSearchProtocol.Key():
-		err = rr.registerStationSearch(i)
+// dropBikeRental cancels the reservation of the bike offered for
+// a rental dropped by either the client or the renter
+func (rr *renterReasoner) dropBikeRental(i bspl.Instance, motive string) {
+	rr.mutex.Lock()
+	offer, found := rr.offers[i.GetValue("ID")]
+	delete(rr.offers, i.GetValue("ID"))
+	rr.mutex.Unlock()
+	if !found {
+		return
 	}
-	if err != nil {
+	logger.Debugf("[%s] Rental for bike %s dropped: %s", shortID(rr.Node.ID()), shortID(offer.bikeID), motive)
+	if err := rr.inventory.cancel(offer.station, offer.bikeID); err != nil {
 		logger.Errorf("[%s] %s", shortID(rr.Node.ID()), err)
 	}
-	return err
 }
 
-func (rr *renterReasoner) registerBikeRental(i bspl.Instance) error {
-	stationID := i.GetValue("origin")
-	if stationID == "" || !rr.hasStation(stationID) {
-		errMsg := fmt.Sprintf("Invalid or null origin station ID: '%s'", stationID)
-		go sendEvent(events.MakeDropEvent(i.Key(), errMsg), i, rr.Node)
-		return errors.New(errMsg)
-	}
-	i.SetValue("price", fmt.Sprint(rr.calculatePrice()))
-	// TODO: check that station is found
-	station := rr.stations[stationID]
-	bike := station.reasoner.bikes.reserveBike()
-	if bike == nil {
-		return fmt.Errorf("No available bikes in station '%s'", station.ID())
+func (rr *renterReasoner) registerBikeNegotiation(i bspl.Instance) error {
+	rentalID := i.GetValue("rentalID")
+	round, err := typed(i).Int("round")
+	if err != nil {
+		return rr.reject(i, err)
 	}
-	i.SetValue("bikeID", bike.ID()) // TODO: select available bike
+	bid, err := typed(i).Float("bid")
+	if err != nil {
+		return rr.reject(i, err)
+	}
+	rr.mutex.Lock()
+	offer, found := rr.offers[rentalID]
+	if !found || offer.client != i.Roles()["Client"] {
+		rr.mutex.Unlock()
+		return fmt.Errorf("No open rental '%s' for the client", rentalID)
+	}
+	// the price answered is the one asked from then on
+	decision, price := rr.negotiation.respond(offer.price, bid, round)
+	offer.agreed = price
+	rr.mutex.Unlock()
+	logger.Debugf("[%s] Answer bid '%.4f' for rental %s in round %d: %s '%.4f'",
+		shortID(rr.Node.ID()), bid, rentalID, round, decision, price)
+	i.SetValue("price", formatPrice(price))
+	i.SetValue("rID", decision.String())
 	go sendEvent(events.MakeUpdateEvent(i), i, rr.Node)
+	rr.complete(i.Key())
 	return nil
 }
 
 func (rr *renterReasoner) registerBikeRequest(i bspl.Instance) error {
-	bikeNumStr := i.GetValue("bikeNum")
-	dtStr := i.GetValue("datetime")
 	stationID := i.GetValue("station")
 	logger.Debugf("[%s] Received request for %s bikes at station %s and time %s",
-		shortID(rr.Node.ID()), bikeNumStr, shortID(stationID), dtStr)
+		shortID(rr.Node.ID()), i.GetValue("bikeNum"), shortID(stationID), i.GetValue("datetime"))
 
 	// check param validity
-	bikeNum, err := strconv.ParseInt(bikeNumStr, 10, 64)
+	bikeNum, err := typed(i).Int("bikeNum")
 	if err != nil {
-		return fmt.Errorf("Invalid bikeNum: '%s'", bikeNumStr)
+		return rr.reject(i, err)
 	}
-	dt, err := time.Parse(time.RFC3339, dtStr)
+	dt, err := typed(i).Time("datetime")
 	if err != nil {
-		return fmt.Errorf("Invalid datetime: '%s'", dtStr)
+		return rr.reject(i, err)
 	}
-	var station *Station
-	for _, s := range rr.stations {
-		if s.ID() == stationID {
-			station = s
-			break
-		}
+	if !rr.hasStation(stationID) {
+		return rr.reject(i, fmt.Errorf("Station '%s' not found", stationID))
 	}
-	if station == nil {
-		return fmt.Errorf("Station '%s' not found", stationID)
+	// the request stays open until the transport is over
+	request := i.Key()
+	job := &transportJob{
+		bikeNum: bikeNum, dst: stationID, datetime: dt, sources: rr.stations,
+		done: func(job *transportJob, reason string) { rr.reportDelivery(request, job, reason) },
 	}
-	errc := make(chan error)
-	result := make(chan string)
-
-	go rr.requestTransport(int(bikeNum), station, dt, result, errc)
-
-	var rID string
-
-	select {
-	case rID = <-result:
-		break
-	case err = <-errc:
+	if err := rr.transports.dispatch(job); err != nil {
 		logger.Errorf("\t[%s] Couldn't request transport to '%s', err: '%s'",
 			shortID(rr.Node.ID()), shortID(stationID), err)
-		return err
-	}
-	offerNum := strconv.Itoa(int(bikeNum))
-	if rID == "accept" {
-		logger.Infof("[%s] Accepting request '%s'", shortID(rr.Node.ID()), i.Key())
-		i.SetValue("rID", "accept")
-		i.SetValue("offerNum", offerNum)
-	} else {
 		logger.Infof("[%s] Rejecting request '%s'", shortID(rr.Node.ID()), i.Key())
 		i.SetValue("rID", "reject")
-		i.SetValue("offerNum", offerNum)
-	}
-	go sendEvent(events.MakeUpdateEvent(i), i, rr.Node)
-	return nil
-}
-
-func (rr *renterReasoner) registerStationSearch(i bspl.Instance) error {
-	cStr := strings.Split(i.GetValue("coordinates"), ",")
-	var errMsg string
-	formatErr := "Incorrectly formatted coordinates"
-	var x, y float64
-	var err error
-	if len(cStr) != 2 {
-		errMsg = formatErr
-	}
-	if x, err = strconv.ParseFloat(cStr[0], 64); err != nil {
-		errMsg = formatErr
-	}
-	if y, err = strconv.ParseFloat(cStr[0], 64); err != nil {
-		errMsg = formatErr
-	}
-	if errMsg != "" {
-		rr.DropInstance(i.Key(), errMsg)
-		go sendEvent(events.MakeDropEvent(i.Key(), errMsg), i, rr.Node)
-		return errors.New(errMsg)
+		typed(i).SetInt("offerNum", bikeNum)
+		go sendEvent(events.MakeUpdateEvent(i), i, rr.Node)
+		rr.complete(i.Key())
+		return nil
 	}
-	station := rr.nearestStation(Coords{X: x, Y: y})
-	i.SetValue("stationID", station.ID())
+	logger.Infof("[%s] Accepting request '%s'", shortID(rr.Node.ID()), i.Key())
+	i.SetValue("rID", "accept")
+	typed(i).SetInt("offerNum", bikeNum)
 	go sendEvent(events.MakeUpdateEvent(i), i, rr.Node)
 	return nil
 }
 
-func (rr *renterReasoner) UpdateInstance(j bspl.Instance) error {
-	i, found := rr.openInstances[j.Key()]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", j.Key())
-	}
-	actions, _, err := i.Diff(j)
-	if err != nil {
-		return err
-	}
-	switch j.Protocol().Key() {
-	case bikeRentalProtocol.Key():
-		err = rr.updateBikeRental(j, actions)
-	case bikeTransportProtocol.Key():
-		err = rr.updateBikeTransport(j, actions)
-	}
-	if err != nil {
-		return err
-	}
-	i.Update(j)
-	return nil
-}
-
 func (rr *renterReasoner) updateBikeRental(j bspl.Instance, actions []bspl.Action) error {
-	if len(actions) != 2 {
-		return errors.New("Unexpected actions")
-	}
-	if actions[0].Name == "accept" {
-		if actions[1].Name != "reject" {
-			return errors.New("Unexpected actions")
-		}
-	} else if actions[0].Name == "reject" {
-		if actions[1].Name != "reject" {
-			return errors.New("Unexpected actions")
-		}
-	} else {
-		return errors.New("Unexpected actions")
-	}
+	// an accept binds the agreed price too, so a reject can't be told
+	// apart from an accept by the values alone
 	client := j.Roles()["Client"]
 	bikeID := j.GetValue("bikeID")
 	rID := j.GetValue("rID")
+	if !demo.HasAction(actions, rID) {
+		return errors.New("Unexpected actions")
+	}
 	logger.Debugf("[%s] Response from %s for bike %s offer: %s", shortID(rr.Node.ID()),
 		shortID(client), shortID(bikeID), rID)
-	return nil
-}
-
-func (rr *renterReasoner) updateBikeTransport(j bspl.Instance, actions []bspl.Action) error {
-	rID := j.GetValue("rID")
-	result := j.GetValue("result")
-	if rID != "" {
-		if result != "" {
-			// success or failure
-		} else {
-			// accept/reject
-			requestResult := rr.transportRequests[j.Key()]
-			requestResult <- rID
+	rr.mutex.Lock()
+	offer, found := rr.offers[j.GetValue("ID")]
+	delete(rr.offers, j.GetValue("ID"))
+	rr.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No open offer for instance '%s'", j.Key())
+	}
+	if rID == "accept" {
+		err := offer.bind(j)
+		if err == nil {
+			// the offer is gone already, so a failed release drops the
+			// instance and returns the bike as a bad bind does
+			err = rr.inventory.release(offer.station, bikeID, j.GetValue("ID"))
 		}
-	} else {
-		return errors.New("Empty rID")
+		if err != nil {
+			if err := rr.inventory.cancel(offer.station, bikeID); err != nil {
+				logger.Errorf("[%s] %s", shortID(rr.Node.ID()), err)
+			}
+			return rr.reject(j, err)
+		}
+		logger.Infof("[%s] Rented bike %s for '%.4f'", shortID(rr.Node.ID()),
+			shortID(bikeID), offer.agreed)
+	} else if err := rr.inventory.cancel(offer.station, bikeID); err != nil {
+		logger.Errorf("[%s] %s", shortID(rr.Node.ID()), err)
 	}
+	rr.complete(j.Key())
 	return nil
 }
 
-func (rr renterReasoner) nearestStation(c Coords) *Station {
-	if len(rr.stations) == 0 {
-		return nil
+// reportDelivery tells the requester of the bikes of a job how many
+// were delivered, along with the reason the rest weren't if any
+func (rr *renterReasoner) reportDelivery(request string, job *transportJob, reason string) {
+	i, found := rr.GetInstance(request)
+	if !found {
+		return
 	}
-
-	minDist := math.MaxFloat64
-	var s *Station
-	for _, ns := range rr.stations {
-		dist := math.Sqrt(math.Pow(ns.Coords().X-c.X, 2) + math.Pow(ns.Coords().Y-c.Y, 2))
-		if dist < minDist {
-			minDist = dist
-			s = ns
-		}
+	typed(i).SetInt("deliveredNum", job.delivered)
+	if reason != "" {
+		logger.Infof("[%s] Only %d bikes of request '%s' were delivered", shortID(rr.Node.ID()),
+			job.delivered, i.Key())
+		i.SetValue("reason", reason)
 	}
-	return s
+	go sendEvent(events.MakeUpdateEvent(i), i, rr.Node)
+	rr.complete(i.Key())
 }
 
-func (rr renterReasoner) calculatePrice() float64 {
-	possiblePrices := []float64{0.01, 0.02, 0.03}
-	rand.Seed(time.Now().Unix())
-	// offer a random price to the client
-	price := possiblePrices[rand.Intn(len(possiblePrices))]
-	return price
+func (rr *renterReasoner) calculatePrice(q PriceQuery) float64 {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	q.Random = rr.random
+	return roundPrice(rr.pricing.Price(q))
 }
 
-func (rr renterReasoner) hasStation(stationID string) bool {
-	for _, s := range rr.stations {
-		if s.ID() == stationID {
-			return true
-		}
+// stationEntries are the stations of the renter as searched by its
+// locator
+func (rr *renterReasoner) stationEntries() []stationEntry {
+	entries := make([]stationEntry, len(rr.stations))
+	for i, s := range rr.stations {
+		entries[i] = stationEntry{id: s, operator: rr.Node.ID().Pretty()}
 	}
-	return false
+	return entries
 }
 
-func (rr *renterReasoner) requestTransport(n int, dst *Station, dt time.Time, result chan string, errc chan error) {
-	transports := rr.Node.FindContact(bikeTransportProtocol.Key(), "Transport")
-	if len(transports) == 0 {
-		errc <- errors.New("no transports fond")
-		return
-	}
-	id := transports[0]
-	logger.Debugf("[%s] Request bike transport from %s", shortID(rr.Node.ID()), shortID(id))
-	// find an station with enough bikes
-	var src *Station
-	m := 0
+func (rr *renterReasoner) hasStation(stationID string) bool {
 	for _, s := range rr.stations {
-		if s.ID() == dst.ID() {
-			continue
-		}
-		if s.reasoner.bikes.available.len() > m {
-			src = s
-			m = s.reasoner.bikes.available.len()
+		if s == stationID {
+			return true
 		}
 	}
-	if src == nil || m < n {
-		errc <- errors.New("couldn't find a station to take bikes from")
-		return
-	}
-	t, err := dt.MarshalText()
-	if err != nil {
-		errc <- err
-		return
-	}
-	roles := bspl.Roles{"Requester": rr.Node.ID().Pretty(), "Transport": id.Pretty()}
-	inputs := bspl.Values{
-		"in src":      src.ID(),
-		"in dst":      dst.ID(),
-		"in bikeNum":  strconv.Itoa(n),
-		"in datetime": string(t),
-	}
-	protocol := bikeTransportProtocol
-	instance, err := rr.Instantiate(protocol, roles, inputs)
-	rr.Node.OpenInstances[instance.Key()] = id
-	if err != nil {
-		errc <- err
-		return
-	}
-
-	go sendEvent(events.MakeNewEvent(instance), instance, rr.Node)
-	rr.transportRequests[instance.Key()] = result
+	return false
 }
@@ -0,0 +1,153 @@
+package v2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// transportWorld has a university whose station is empty and a station
+// with two bikes to take them from, on a virtual clock moved by the test
+func transportWorld(t *testing.T) *World {
+	s := Scenario{
+		Speedup: 1,
+		Start:   time.Date(2020, 6, 18, 8, 0, 0, 0, time.UTC),
+		Stations: []StationSpec{
+			{Name: "s1", Coords: Coords{Lat: 0.00008, Lon: 0.00008}},
+			{Name: "s2", Coords: Coords{Lat: 0.0004, Lon: 0.0004}, Bikes: 2},
+		},
+		Renters:      []RenterSpec{{Name: "r", Stations: []string{"s1", "s2"}}},
+		Transports:   []TransportSpec{{Name: "t", Stations: []string{"s1", "s2"}}},
+		Universities: []UniversitySpec{{Name: "u", Station: "s1"}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// runUntil moves the virtual clock of a world from timer to timer until
+// done, but never past the horizon, so deadlines after it don't expire
+// however long the messages between the agents take. The real time
+// limit only stops a stuck test.
+func runUntil(t *testing.T, w *World, horizon time.Time, done func() bool) {
+	vc := w.Clock.(*VirtualClock)
+	for start := time.Now(); !done(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("Stuck at %v", vc.Now())
+		}
+		if next, found := vc.nextTimer(); found && !next.After(horizon) {
+			vc.Advance(next.Sub(vc.Now()))
+		}
+	}
+}
+
+// requestBikes for the university of a world due in an hour, the number
+// of bikes delivered is sent once reported
+func requestBikes(t *testing.T, w *World, n int) (<-chan int, time.Time) {
+	due := w.Clock.Now().Add(time.Hour)
+	delivered := make(chan int, 1)
+	go func() {
+		n, err := w.Universities["u"].RequestBikes(n, due)
+		if err != nil {
+			t.Error(err)
+		}
+		delivered <- n
+	}()
+	return delivered, due
+}
+
+// awaitDelivery of the bikes requested, the clock is kept short of the
+// deadline of the university
+func awaitDelivery(t *testing.T, w *World, due time.Time, delivered <-chan int) int {
+	n := 0
+	runUntil(t, w, due.Add(deliveryGrace/2), func() bool {
+		select {
+		case n = <-delivered:
+			return true
+		default:
+			return false
+		}
+	})
+	return n
+}
+
+// hauling tells whether a transport accepted a haul it hasn't left for
+func hauling(tr Transport) func() bool {
+	return func() bool {
+		tr.reasoner.mutex.Lock()
+		defer tr.reasoner.mutex.Unlock()
+		return len(tr.reasoner.queue) > 0
+	}
+}
+
+func TestBikeOffer_bind(t *testing.T) {
+	offer := &bikeOffer{price: 0.2, agreed: 0.15}
+	for agreed, valid := range map[string]bool{"0.15": true, "0.2": false, "": false} {
+		i := imp.NewInstance(bikeRentalProtocol, bspl.Roles{})
+		if agreed != "" {
+			i.SetValue("agreed", agreed)
+		}
+		if err := offer.bind(i); (err == nil) != valid {
+			t.Errorf("Accepted at '%s': expected valid %t, got %v", agreed, valid, err)
+		}
+	}
+}
+
+func TestRenter_transportSuccess(t *testing.T) {
+	w := transportWorld(t)
+	delivered, due := requestBikes(t, w, 2)
+	if n := awaitDelivery(t, w, due, delivered); n != 2 {
+		t.Errorf("Expected 2 bikes delivered, got %d", n)
+	}
+}
+
+func TestRenter_transportFailure(t *testing.T) {
+	w := transportWorld(t)
+	delivered, due := requestBikes(t, w, 2)
+	// take a bike once the haul is accepted, the clock stands still so
+	// the transport can't leave to pick the bikes up meanwhile
+	runUntil(t, w, w.Clock.Now(), hauling(w.Transports["t"]))
+	w.Stations["s2"].reasoner.bikes.reserveBike(due.Add(time.Hour))
+	// the bike left is delivered anyway
+	if n := awaitDelivery(t, w, due, delivered); n != 1 {
+		t.Errorf("Expected 1 bike delivered, got %d", n)
+	}
+	// the values of the university's copy are written after completing it
+	requests := w.Renters["r"].reasoner.InstancesIn(bikeRequestProtocol, demo.InstanceCompleted)
+	if len(requests) != 1 || requests[0].GetValue("reason") == "" {
+		t.Error("Undelivered request without reason")
+	}
+	transports := w.Transports["t"].Instances(bikeTransportProtocol, demo.InstanceCompleted)
+	if len(transports) != 1 || transports[0].GetValue("result") != "failure" {
+		t.Errorf("Expected a failed transport, got %v", transports)
+	}
+}
+
+// rentals at stations without bikes are dropped, not left open
+func TestRenter_noBikes(t *testing.T) {
+	s := Scenario{
+		Stations: []StationSpec{{Name: "s1", Coords: Coords{Lat: 0, Lon: 0}}},
+		Renters:  []RenterSpec{{Name: "r", Stations: []string{"s1"}}},
+		People:   []PersonSpec{{Name: "p"}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := w.Renters["r"]
+	i := imp.NewInstance(bikeRentalProtocol, bspl.Roles{"Client": w.People["p"].Node.ID().Pretty(), "Renter": r.ID()})
+	i.SetValue("ID", "rental")
+	i.SetValue("origin", w.Stations["s1"].ID())
+	i.SetValue("destination", Coords{Lat: 0.001, Lon: 0.001}.String())
+	if err := r.reasoner.RegisterInstance(i); err == nil {
+		t.Fatal("Bike offered at a station without bikes")
+	}
+	if open := r.Instances(bikeRentalProtocol); len(open) != 0 {
+		t.Errorf("Expected no open rentals, got %d", len(open))
+	}
+}
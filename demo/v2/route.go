@@ -0,0 +1,201 @@
+package v2
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// haul is a transport of bikes between two stations accepted by a
+// transport, due when the bikes must be at the destination
+type haul struct {
+	// key of the BikeTransport instance
+	key   string
+	src   stationInfo
+	dst   stationInfo
+	bikes int
+	due   time.Time
+
+	// bikes picked up and the keys of the rides, set during the trip
+	picked []string
+	rides  []string
+	// dropped is the number of bikes picked up that docked at the
+	// destination, the rest are taken elsewhere once the trip is over
+	dropped int
+	// failure is the reason not every bike was picked up, if any
+	failure string
+}
+
+// stop of a trip where the bikes of a haul are picked up or dropped
+type stop struct {
+	station stationInfo
+	haul    *haul
+	pickup  bool
+}
+
+// trip of a vehicle carrying the bikes of several hauls at once, the
+// bikes are picked up before any is dropped
+type trip struct {
+	hauls []*haul
+	stops []stop
+	// departure from the position of the vehicle and arrival at each stop
+	departure time.Time
+	arrivals  []time.Time
+	// unreachable is set if no way leads to some stop
+	unreachable bool
+}
+
+// load is the number of bikes carried at once during the trip
+func (t *trip) load() int {
+	n := 0
+	for _, h := range t.hauls {
+		n += h.bikes
+	}
+	return n
+}
+
+// end of the trip, the arrival at its last stop
+func (t *trip) end() time.Time {
+	if len(t.arrivals) == 0 {
+		return t.departure
+	}
+	return t.arrivals[len(t.arrivals)-1]
+}
+
+// slack is how long the departure can be delayed with every haul of
+// the trip still on time, negative if some is late or unreachable
+func (t *trip) slack() time.Duration {
+	if t.unreachable {
+		return time.Duration(math.MinInt64)
+	}
+	slack := time.Duration(math.MaxInt64)
+	for i, s := range t.stops {
+		if s.pickup {
+			continue
+		}
+		if d := s.haul.due.Sub(t.arrivals[i]); d < slack {
+			slack = d
+		}
+	}
+	return slack
+}
+
+// vehicle is the state of a transport planning its trips
+type vehicle struct {
+	// position of the vehicle once free
+	position Coords
+	// free is when the vehicle finishes its current trip, if any
+	free     time.Time
+	capacity int
+	// speed in meters per second
+	speed float64
+	// distances along the way of the vehicle
+	distances DistanceProvider
+}
+
+// travelTime between two points at the speed of the vehicle, false if
+// no way leads from one to the other
+func (v vehicle) travelTime(a, b Coords) (time.Duration, bool) {
+	d := v.distances.Distance(a, b)
+	if !reachable(d) {
+		return 0, false
+	}
+	seconds := d / v.speed
+	if seconds >= float64(math.MaxInt64/int64(time.Second)) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// route the stops of a trip leaving at a time: the pickups in nearest
+// neighbour order and the drops in order of due time
+func (v vehicle) route(hauls []*haul, departure time.Time) *trip {
+	t := &trip{hauls: hauls, departure: departure}
+	pickups := make([]stop, 0, len(hauls))
+	drops := make([]stop, 0, len(hauls))
+	for _, h := range hauls {
+		pickups = append(pickups, stop{station: h.src, haul: h, pickup: true})
+		drops = append(drops, stop{station: h.dst, haul: h})
+	}
+	position := v.position
+	for len(pickups) > 0 {
+		nearest := 0
+		for i, s := range pickups {
+			if v.distances.Distance(position, s.station.coords) < v.distances.Distance(position, pickups[nearest].station.coords) {
+				nearest = i
+			}
+		}
+		t.stops = append(t.stops, pickups[nearest])
+		position = pickups[nearest].station.coords
+		pickups = append(pickups[:nearest], pickups[nearest+1:]...)
+	}
+	sort.SliceStable(drops, func(i, j int) bool { return drops[i].haul.due.Before(drops[j].haul.due) })
+	t.stops = append(t.stops, drops...)
+
+	position = v.position
+	arrival := departure
+	for _, s := range t.stops {
+		d, ok := v.travelTime(position, s.station.coords)
+		if !ok {
+			t.unreachable = true
+		}
+		arrival = arrival.Add(d)
+		t.arrivals = append(t.arrivals, arrival)
+		position = s.station.coords
+	}
+	return t
+}
+
+// plan the trips of the vehicle to carry the bikes of the hauls from a
+// time on. The hauls are taken in order of due time and batched into a
+// trip as long as they fit in the vehicle and every one arrives on
+// time. Returns whether every haul arrives on time.
+func (v vehicle) plan(hauls []*haul, now time.Time) ([]*trip, bool) {
+	pending := make([]*haul, len(hauls))
+	copy(pending, hauls)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].due.Before(pending[j].due) })
+	start := now
+	if v.free.After(start) {
+		start = v.free
+	}
+	trips := make([]*trip, 0)
+	feasible := true
+	for len(pending) > 0 {
+		batch := []*haul{pending[0]}
+		load := pending[0].bikes
+		rest := make([]*haul, 0, len(pending))
+		for _, h := range pending[1:] {
+			if load+h.bikes > v.capacity {
+				rest = append(rest, h)
+				continue
+			}
+			if v.route(append(batch[:len(batch):len(batch)], h), start).slack() < 0 {
+				rest = append(rest, h)
+				continue
+			}
+			batch = append(batch, h)
+			load += h.bikes
+		}
+		t := v.route(batch, start)
+		if load > v.capacity || t.slack() < 0 {
+			feasible = false
+		}
+		trips = append(trips, t)
+		v.position = t.stops[len(t.stops)-1].station.coords
+		start = t.end()
+		pending = rest
+	}
+	return trips, feasible
+}
+
+// slack of a plan, how long the first trip can be delayed with every
+// haul still on time
+func slack(trips []*trip) time.Duration {
+	slack := time.Duration(math.MaxInt64)
+	for _, t := range trips {
+		if s := t.slack(); s < slack {
+			slack = s
+		}
+	}
+	return slack
+}
@@ -0,0 +1,71 @@
+package v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVehicle_plan(t *testing.T) {
+	now := time.Now()
+	a := stationInfo{id: "a", coords: Coords{Lat: 0, Lon: 0}}
+	b := stationInfo{id: "b", coords: Coords{Lat: 0, Lon: 0.001}}
+	c := stationInfo{id: "c", coords: Coords{Lat: 0, Lon: 0.002}}
+	// a second from one station to the next
+	speed := Euclidean{}.Distance(a.coords, b.coords)
+	v := vehicle{position: a.coords, capacity: 4, speed: speed, distances: Euclidean{}}
+
+	// both hauls fit and arrive on time in a single trip: a, b, c
+	first := &haul{key: "1", src: a, dst: b, bikes: 2, due: now.Add(3 * time.Second)}
+	second := &haul{key: "2", src: a, dst: c, bikes: 2, due: now.Add(3500 * time.Millisecond)}
+	trips, feasible := v.plan([]*haul{second, first}, now)
+	if !feasible || len(trips) != 1 {
+		t.Fatalf("Expected a single feasible trip, got %d (%t)", len(trips), feasible)
+	}
+	if stops := trips[0].stops; len(stops) != 4 || stops[2].haul != first || stops[3].haul != second {
+		t.Error("Bikes not dropped in order of due time")
+	}
+	if s := slack(trips); s < 1500*time.Millisecond-time.Microsecond || s > 1500*time.Millisecond+time.Microsecond {
+		t.Errorf("Expected 1.5s of slack, got %v", s)
+	}
+
+	// the vehicle can't carry every bike at once
+	v.capacity = 3
+	trips, feasible = v.plan([]*haul{first, second}, now)
+	if len(trips) != 2 {
+		t.Fatalf("Expected 2 trips, got %d", len(trips))
+	}
+	if feasible {
+		t.Error("Late haul planned as feasible")
+	}
+
+	// too many bikes for the vehicle
+	if _, feasible := v.plan([]*haul{{src: a, dst: b, bikes: 4, due: now.Add(time.Hour)}}, now); feasible {
+		t.Error("Haul over capacity planned as feasible")
+	}
+}
+
+func TestVehicle_planUnreachable(t *testing.T) {
+	now := time.Now()
+	// two streets with no way between them
+	n := NewStreetNetwork()
+	n.AddStreet([]Coords{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 0.001}}, false)
+	n.AddStreet([]Coords{{Lat: 0.01, Lon: 0}, {Lat: 0.01, Lon: 0.001}}, false)
+	a := stationInfo{id: "a", coords: Coords{Lat: 0, Lon: 0}}
+	b := stationInfo{id: "b", coords: Coords{Lat: 0, Lon: 0.001}}
+	c := stationInfo{id: "c", coords: Coords{Lat: 0.01, Lon: 0.001}}
+	v := vehicle{position: a.coords, capacity: 4, speed: 10, distances: n}
+
+	if _, ok := v.travelTime(a.coords, c.coords); ok {
+		t.Error("Travel time between unconnected streets")
+	}
+	if _, feasible := v.plan([]*haul{{src: a, dst: b, bikes: 1, due: now.Add(time.Hour)}}, now); !feasible {
+		t.Error("Haul along a street planned as infeasible")
+	}
+	trips, feasible := v.plan([]*haul{{src: a, dst: c, bikes: 1, due: now.Add(time.Hour)}}, now)
+	if feasible || !trips[0].unreachable {
+		t.Error("Haul between unconnected streets planned as feasible")
+	}
+	if slack(trips) >= 0 {
+		t.Errorf("Expected a negative slack, got %v", slack(trips))
+	}
+}
@@ -0,0 +1,611 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+// Scenario describes a world of agents and what they do
+type Scenario struct {
+	// Speedup runs the scenario on a virtual clock that goes Speedup
+	// times faster than the real one, the real clock is used if zero
+	Speedup float64 `json:"speedup"`
+	// Start is the initial time of the virtual clock, now if not set
+	Start time.Time `json:"start"`
+	// Seed of the random sources of the agents, a random seed is
+	// used if zero
+	Seed int64 `json:"seed"`
+	// Duration the scenario runs for at least, e.g. "1m" to let the
+	// rebalancers act once the people and universities are done
+	Duration string `json:"duration"`
+	// Distance is how the agents measure distances, in a straight line
+	// if not set. The street network file is relative to the scenario.
+	Distance *DistanceSpec `json:"distance"`
+
+	Stations     []StationSpec    `json:"stations"`
+	Renters      []RenterSpec     `json:"renters"`
+	Transports   []TransportSpec  `json:"transports"`
+	Universities []UniversitySpec `json:"universities"`
+	People       []PersonSpec     `json:"people"`
+	Rebalancers  []RebalancerSpec `json:"rebalancers"`
+	Locators     []LocatorSpec    `json:"locators"`
+}
+
+// StationSpec describes a station, the bikes initially docked at it and
+// its dock slots, unlimited if not set
+type StationSpec struct {
+	Name   string `json:"name"`
+	Coords Coords `json:"coords"`
+	Bikes  int    `json:"bikes"`
+	Docks  int    `json:"docks"`
+}
+
+// RenterSpec describes a renter, the names of the stations it controls
+// and its pricing strategy, random prices are offered if not set, and
+// negotiation strategy, counter-offers are rejected if not set.
+// ReservationTTL is how long offered bikes are held, e.g. "1m".
+type RenterSpec struct {
+	Name           string          `json:"name"`
+	Stations       []string        `json:"stations"`
+	Pricing        *PricingSpec    `json:"pricing"`
+	Negotiation    *SellerStrategy `json:"negotiation"`
+	ReservationTTL string          `json:"reservationTTL"`
+}
+
+// TransportSpec describes a transport, the names of the stations it
+// serves and its vehicle: where it starts, the first station if not
+// set, how many bikes it carries and its speed in meters per second,
+// 10 bikes and 100 if not set
+type TransportSpec struct {
+	Name     string   `json:"name"`
+	Stations []string `json:"stations"`
+	Coords   *Coords  `json:"coords"`
+	Capacity int      `json:"capacity"`
+	Speed    float64  `json:"speed"`
+}
+
+// RebalancerSpec describes a rebalancer, the names of the stations it
+// watches and its policy, the default one if not set
+type RebalancerSpec struct {
+	Name     string         `json:"name"`
+	Stations []string       `json:"stations"`
+	Policy   *RebalanceSpec `json:"policy"`
+}
+
+// LocatorSpec describes a locator and the names of the stations
+// registered with it, each one by the first renter controlling it
+type LocatorSpec struct {
+	Name     string   `json:"name"`
+	Stations []string `json:"stations"`
+}
+
+// UniversitySpec describes a university, the name of its nearest
+// station and its requests of bikes
+type UniversitySpec struct {
+	Name     string        `json:"name"`
+	Station  string        `json:"station"`
+	Requests []RequestSpec `json:"requests"`
+}
+
+// RequestSpec is a request of bikes sent After the start of the
+// scenario for bikes needed In a while after being sent, e.g. "2s"
+type RequestSpec struct {
+	Bikes int    `json:"bikes"`
+	After string `json:"after"`
+	In    string `json:"in"`
+}
+
+// PersonSpec describes a person, their negotiation strategy, prices up
+// to 0.2 are accepted without countering if not set, their shopping
+// strategy, how they choose stations, the nearest one if not set, the
+// name of the locator they search stations with, each renter is asked
+// if not set, and their trips, made one after another
+type PersonSpec struct {
+	Name              string             `json:"name"`
+	Locator           string             `json:"locator"`
+	Negotiation       *BuyerStrategy     `json:"negotiation"`
+	Shopping          *ShoppingSpec      `json:"shopping"`
+	StationPreference *StationPreference `json:"stationPreference"`
+	Trips             []TripSpec         `json:"trips"`
+}
+
+// TripSpec is a trip of a person
+type TripSpec struct {
+	From Coords `json:"from"`
+	To   Coords `json:"to"`
+}
+
+// LoadScenario reads and validates a scenario from a JSON file
+func LoadScenario(path string) (Scenario, error) {
+	s := Scenario{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("Invalid scenario '%s': %s", path, err)
+	}
+	if s.Distance != nil && s.Distance.Network != "" && !filepath.IsAbs(s.Distance.Network) {
+		s.Distance.Network = filepath.Join(filepath.Dir(path), s.Distance.Network)
+	}
+	return s, s.Validate()
+}
+
+// Validate checks that names are unique and that every
+// referenced station exists
+func (s Scenario) Validate() error {
+	if s.Speedup < 0 {
+		return fmt.Errorf("Invalid speedup: %f", s.Speedup)
+	}
+	if s.Duration != "" {
+		if _, err := time.ParseDuration(s.Duration); err != nil {
+			return fmt.Errorf("Invalid duration: '%s'", s.Duration)
+		}
+	}
+	if s.Distance != nil {
+		if err := s.Distance.Validate(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	stations := make(map[string]bool)
+	add := func(name string) error {
+		if name == "" {
+			return fmt.Errorf("Missing agent name")
+		}
+		if names[name] {
+			return fmt.Errorf("Agent '%s' already existed", name)
+		}
+		names[name] = true
+		return nil
+	}
+	for _, st := range s.Stations {
+		if err := add(st.Name); err != nil {
+			return err
+		}
+		if st.Bikes < 0 {
+			return fmt.Errorf("Invalid bike number for station '%s': %d", st.Name, st.Bikes)
+		}
+		if st.Docks < 0 || st.Docks > 0 && st.Bikes > st.Docks {
+			return fmt.Errorf("Invalid dock number for station '%s': %d", st.Name, st.Docks)
+		}
+		if err := st.Coords.Validate(); err != nil {
+			return fmt.Errorf("Invalid coordinates of '%s': %s", st.Name, err)
+		}
+		stations[st.Name] = true
+	}
+	checkStations := func(agent string, refs ...string) error {
+		for _, ref := range refs {
+			if !stations[ref] {
+				return fmt.Errorf("Station '%s' of '%s' not found", ref, agent)
+			}
+		}
+		return nil
+	}
+	for _, r := range s.Renters {
+		if err := add(r.Name); err != nil {
+			return err
+		}
+		if err := checkStations(r.Name, r.Stations...); err != nil {
+			return err
+		}
+		if r.Pricing != nil {
+			if _, err := r.Pricing.NewStrategy(); err != nil {
+				return fmt.Errorf("Invalid pricing of '%s': %s", r.Name, err)
+			}
+		}
+		if r.Negotiation != nil {
+			if err := r.Negotiation.Validate(); err != nil {
+				return fmt.Errorf("Invalid negotiation of '%s': %s", r.Name, err)
+			}
+		}
+		if r.ReservationTTL != "" {
+			if ttl, err := time.ParseDuration(r.ReservationTTL); err != nil || ttl <= 0 {
+				return fmt.Errorf("Invalid reservation TTL of '%s': '%s'", r.Name, r.ReservationTTL)
+			}
+		}
+	}
+	for _, t := range s.Transports {
+		if err := add(t.Name); err != nil {
+			return err
+		}
+		if err := checkStations(t.Name, t.Stations...); err != nil {
+			return err
+		}
+		if t.Capacity < 0 || t.Speed < 0 {
+			return fmt.Errorf("Invalid vehicle of '%s'", t.Name)
+		}
+		if t.Coords != nil {
+			if err := t.Coords.Validate(); err != nil {
+				return fmt.Errorf("Invalid coordinates of '%s': %s", t.Name, err)
+			}
+		}
+	}
+	for _, r := range s.Rebalancers {
+		if err := add(r.Name); err != nil {
+			return err
+		}
+		if err := checkStations(r.Name, r.Stations...); err != nil {
+			return err
+		}
+		if r.Policy != nil {
+			if _, err := r.Policy.NewPolicy(); err != nil {
+				return fmt.Errorf("Invalid policy of '%s': %s", r.Name, err)
+			}
+		}
+	}
+	locators := make(map[string]bool)
+	for _, l := range s.Locators {
+		if err := add(l.Name); err != nil {
+			return err
+		}
+		if err := checkStations(l.Name, l.Stations...); err != nil {
+			return err
+		}
+		locators[l.Name] = true
+	}
+	for _, u := range s.Universities {
+		if err := add(u.Name); err != nil {
+			return err
+		}
+		if err := checkStations(u.Name, u.Station); err != nil {
+			return err
+		}
+		for _, r := range u.Requests {
+			if _, err := time.ParseDuration(r.After); err != nil {
+				return fmt.Errorf("Invalid request delay of '%s': '%s'", u.Name, r.After)
+			}
+			if _, err := time.ParseDuration(r.In); err != nil {
+				return fmt.Errorf("Invalid request time of '%s': '%s'", u.Name, r.In)
+			}
+		}
+	}
+	for _, p := range s.People {
+		if err := add(p.Name); err != nil {
+			return err
+		}
+		if p.Negotiation != nil {
+			if err := p.Negotiation.Validate(); err != nil {
+				return fmt.Errorf("Invalid negotiation of '%s': %s", p.Name, err)
+			}
+		}
+		if p.Shopping != nil {
+			if _, err := p.Shopping.NewStrategy(); err != nil {
+				return fmt.Errorf("Invalid shopping of '%s': %s", p.Name, err)
+			}
+		}
+		if p.StationPreference != nil {
+			if err := p.StationPreference.Validate(); err != nil {
+				return fmt.Errorf("Invalid station preference of '%s': %s", p.Name, err)
+			}
+		}
+		if p.Locator != "" && !locators[p.Locator] {
+			return fmt.Errorf("Locator '%s' of '%s' not found", p.Locator, p.Name)
+		}
+		for _, t := range p.Trips {
+			for _, c := range []Coords{t.From, t.To} {
+				if err := c.Validate(); err != nil {
+					return fmt.Errorf("Invalid trip of '%s': %s", p.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// World is the set of agents built from a scenario
+type World struct {
+	scenario Scenario
+	// Clock shared by every agent of the world
+	Clock Clock
+	// Seed the random sources of the agents derive from
+	Seed int64
+
+	Bikes        []Bike
+	Stations     map[string]Station
+	Renters      map[string]Renter
+	Transports   map[string]Transport
+	Universities map[string]University
+	People       map[string]Person
+	Rebalancers  map[string]Rebalancer
+	Locators     map[string]Locator
+}
+
+// Build the agents of a scenario, introduce them to each other, dock
+// the bikes at their stations and register the stations with the
+// locators
+func (s Scenario) Build() (*World, error) {
+	w := &World{
+		scenario:     s,
+		Bikes:        make([]Bike, 0),
+		Stations:     make(map[string]Station),
+		Renters:      make(map[string]Renter),
+		Transports:   make(map[string]Transport),
+		Universities: make(map[string]University),
+		People:       make(map[string]Person),
+		Rebalancers:  make(map[string]Rebalancer),
+		Locators:     make(map[string]Locator),
+	}
+	w.Clock = WallClock{}
+	if s.Speedup > 0 {
+		start := s.Start
+		if start.IsZero() {
+			start = time.Now()
+		}
+		w.Clock = NewVirtualClock(start)
+	}
+	w.Seed = s.Seed
+	if w.Seed == 0 {
+		w.Seed = time.Now().UnixNano()
+	}
+	logger.Infof("Building scenario with seed %d", w.Seed)
+	var distances DistanceProvider
+	if s.Distance != nil {
+		var err error
+		if distances, err = s.Distance.NewProvider(); err != nil {
+			return nil, err
+		}
+	}
+	// the agents share the clock and the distances, each draws from a
+	// source of its own seeded by its name
+	options := func(kind, name string) AgentOptions {
+		return AgentOptions{Clock: w.Clock, Distances: distances, Random: agentRand(w.Seed, kind+"/"+name)}
+	}
+
+	nodes := make([]*nahs.Node, 0)
+	docks := make(map[int]string)
+	for _, spec := range s.Stations {
+		st := NewStation(options("station", spec.Name), spec.Coords)
+		st.SetDocks(spec.Docks)
+		w.Stations[spec.Name] = st
+		nodes = append(nodes, st.Node)
+		for i := 0; i < spec.Bikes; i++ {
+			b := NewBike(options("bike", fmt.Sprintf("%s/%d", spec.Name, i)))
+			docks[len(w.Bikes)] = st.ID()
+			w.Bikes = append(w.Bikes, b)
+			nodes = append(nodes, b.Node)
+		}
+	}
+	for _, spec := range s.Renters {
+		r := NewRenter(options("renter", spec.Name), w.stationIDs(spec.Stations...)...)
+		if spec.Pricing != nil {
+			pricing, err := spec.Pricing.NewStrategy()
+			if err != nil {
+				return nil, err
+			}
+			r.SetPricing(pricing)
+		}
+		if spec.Negotiation != nil {
+			r.SetNegotiation(*spec.Negotiation)
+		}
+		if spec.ReservationTTL != "" {
+			ttl, _ := time.ParseDuration(spec.ReservationTTL)
+			r.SetReservationTTL(ttl)
+		}
+		w.Renters[spec.Name] = r
+		nodes = append(nodes, r.Node)
+	}
+	for _, spec := range s.Transports {
+		t := NewTransport(options("transport", spec.Name), w.stationIDs(spec.Stations...)...)
+		if spec.Coords != nil {
+			t.SetPosition(*spec.Coords)
+		} else if len(spec.Stations) > 0 {
+			t.SetPosition(w.Stations[spec.Stations[0]].Coords())
+		}
+		t.SetVehicle(spec.Capacity, spec.Speed)
+		w.Transports[spec.Name] = t
+		nodes = append(nodes, t.Node)
+	}
+	for _, spec := range s.Universities {
+		u := NewUniversity(options("university", spec.Name), w.Stations[spec.Station].ID())
+		w.Universities[spec.Name] = u
+		nodes = append(nodes, u.Node)
+	}
+	for _, spec := range s.Rebalancers {
+		r := NewRebalancer(options("rebalancer", spec.Name), w.stationIDs(spec.Stations...)...)
+		if spec.Policy != nil {
+			policy, err := spec.Policy.NewPolicy()
+			if err != nil {
+				return nil, err
+			}
+			r.SetPolicy(policy)
+		}
+		w.Rebalancers[spec.Name] = r
+		nodes = append(nodes, r.Node)
+	}
+	for _, spec := range s.Locators {
+		l := NewLocator(options("locator", spec.Name))
+		w.Locators[spec.Name] = l
+		nodes = append(nodes, l.Node)
+	}
+	for _, spec := range s.People {
+		p := NewPerson(options("person", spec.Name))
+		if spec.Locator != "" {
+			if err := p.SetLocator(w.Locators[spec.Locator].ID()); err != nil {
+				return nil, err
+			}
+		}
+		if spec.Negotiation != nil {
+			p.SetNegotiation(*spec.Negotiation)
+		}
+		if spec.Shopping != nil {
+			shopping, err := spec.Shopping.NewStrategy()
+			if err != nil {
+				return nil, err
+			}
+			p.SetShopping(shopping)
+		}
+		if spec.StationPreference != nil {
+			p.SetStationPreference(*spec.StationPreference)
+		}
+		w.People[spec.Name] = p
+		nodes = append(nodes, p.Node)
+	}
+
+	demo.IntroduceNodes(nodes...)
+	for i, b := range w.Bikes {
+		if err := b.Dock(docks[i]); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range s.Locators {
+		for _, name := range spec.Stations {
+			operator := ""
+			for _, r := range s.Renters {
+				if sharesStation(r.Stations, []string{name}) {
+					operator = w.Renters[r.Name].ID()
+					break
+				}
+			}
+			if err := w.Stations[name].Register(w.Locators[spec.Name].ID(), operator); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.addContacts()
+	return w, nil
+}
+
+// addContacts lets people reach every renter, renters and rebalancers
+// reach the transports serving their stations and universities reach
+// the renters controlling their nearest station
+func (w *World) addContacts() {
+	transportService := net.Service{
+		Roles: []bspl.Role{"Transport"}, Protocol: bikeTransportProtocol,
+	}
+	for _, r := range w.scenario.Rebalancers {
+		for _, t := range w.scenario.Transports {
+			if sharesStation(r.Stations, t.Stations) {
+				w.Rebalancers[r.Name].Node.AddContact(w.Transports[t.Name].Node.ID(), transportService)
+			}
+		}
+	}
+	renterServices := []net.Service{
+		{Roles: []bspl.Role{"Renter"}, Protocol: bikeRentalProtocol},
+		{Roles: []bspl.Role{"Locator"}, Protocol: stationSearchProtocol},
+	}
+	for _, r := range w.scenario.Renters {
+		renter := w.Renters[r.Name]
+		for _, p := range w.People {
+			p.Node.AddContact(renter.Node.ID(), renterServices...)
+		}
+		for _, t := range w.scenario.Transports {
+			if !sharesStation(r.Stations, t.Stations) {
+				continue
+			}
+			renter.Node.AddContact(w.Transports[t.Name].Node.ID(), transportService)
+		}
+		for _, u := range w.scenario.Universities {
+			if !sharesStation(r.Stations, []string{u.Station}) {
+				continue
+			}
+			w.Universities[u.Name].Node.AddContact(renter.Node.ID(), net.Service{
+				Roles: []bspl.Role{"Renter"}, Protocol: bikeRequestProtocol,
+			})
+		}
+	}
+}
+
+// Run the requests of the universities, the trips of the people and
+// the rebalancers, and wait until the requests and trips are over and
+// the duration of the scenario has passed. The first error is returned.
+func (w *World) Run() error {
+	var wg sync.WaitGroup
+	errc := make(chan error, 1)
+	if vc, virtual := w.Clock.(*VirtualClock); virtual {
+		stop := vc.Drive(w.scenario.Speedup)
+		defer stop()
+	}
+	start := w.Clock.Now()
+	stop := make(chan struct{})
+	var rebalancers sync.WaitGroup
+	for _, r := range w.Rebalancers {
+		rebalancers.Add(1)
+		go func(r Rebalancer) {
+			defer rebalancers.Done()
+			r.Run(stop)
+		}(r)
+	}
+	// the rebalancers stop once the scenario is over
+	defer rebalancers.Wait()
+	defer close(stop)
+	if w.scenario.Duration != "" {
+		duration, _ := time.ParseDuration(w.scenario.Duration)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Clock.Sleep(start.Add(duration).Sub(w.Clock.Now()))
+		}()
+	}
+	for _, spec := range w.scenario.Universities {
+		u := w.Universities[spec.Name]
+		for _, r := range spec.Requests {
+			wg.Add(1)
+			go func(r RequestSpec) {
+				defer wg.Done()
+				after, _ := time.ParseDuration(r.After)
+				in, _ := time.ParseDuration(r.In)
+				w.Clock.Sleep(start.Add(after).Sub(w.Clock.Now()))
+				if _, err := u.RequestBikes(r.Bikes, w.Clock.Now().Add(in)); err != nil {
+					pushError(errc, err)
+				}
+			}(r)
+		}
+	}
+	for _, spec := range w.scenario.People {
+		wg.Add(1)
+		go func(p Person, trips []TripSpec) {
+			defer wg.Done()
+			for _, t := range trips {
+				if err := p.Travel(t.From, t.To); err != nil {
+					pushError(errc, err)
+					return
+				}
+			}
+		}(w.People[spec.Name], spec.Trips)
+	}
+	wg.Wait()
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (w *World) stationIDs(names ...string) []string {
+	ids := make([]string, len(names))
+	for i, name := range names {
+		ids[i] = w.Stations[name].ID()
+	}
+	return ids
+}
+
+// pushError without blocking if an error was already pushed
+func pushError(errc chan error, err error) {
+	select {
+	case errc <- err:
+	default:
+	}
+}
+
+func sharesStation(a, b []string) bool {
+	for _, s1 := range a {
+		for _, s2 := range b {
+			if s1 == s2 {
+				return true
+			}
+		}
+	}
+	return false
+}
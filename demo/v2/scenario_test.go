@@ -0,0 +1,108 @@
+package v2
+
+import (
+	"testing"
+)
+
+const defaultScenario = "../../scenarios/default.json"
+
+func TestLoadScenario(t *testing.T) {
+	s, err := LoadScenario(defaultScenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Stations) == 0 {
+		t.Error("No stations loaded")
+	}
+}
+
+func TestScenario_Validate(t *testing.T) {
+	valid := Scenario{
+		Stations: []StationSpec{{Name: "s1", Bikes: 1}},
+		Renters:  []RenterSpec{{Name: "r1", Stations: []string{"s1"}}},
+		Universities: []UniversitySpec{{
+			Name: "u1", Station: "s1",
+			Requests: []RequestSpec{{Bikes: 1, After: "1s", In: "2s"}},
+		}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	duplicated := valid
+	duplicated.People = []PersonSpec{{Name: "s1"}}
+	if err := duplicated.Validate(); err == nil {
+		t.Error("Duplicated name accepted")
+	}
+
+	missingStation := valid
+	missingStation.Transports = []TransportSpec{{Name: "t1", Stations: []string{"s2"}}}
+	if err := missingStation.Validate(); err == nil {
+		t.Error("Missing station accepted")
+	}
+
+	invalidRequest := valid
+	invalidRequest.Universities = []UniversitySpec{{
+		Name: "u1", Station: "s1",
+		Requests: []RequestSpec{{Bikes: 1, After: "soon", In: "2s"}},
+	}}
+	if err := invalidRequest.Validate(); err == nil {
+		t.Error("Invalid request delay accepted")
+	}
+}
+
+func TestScenario_BuildSeed(t *testing.T) {
+	draw := func(renters ...string) int64 {
+		s := Scenario{Seed: 42, Stations: []StationSpec{{Name: "s1"}}}
+		for _, name := range renters {
+			s.Renters = append(s.Renters, RenterSpec{Name: name, Stations: []string{"s1"}})
+		}
+		w, err := s.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w.Renters["r1"].reasoner.random.Int63()
+	}
+	if draw("r1") != draw("r0", "r1") {
+		t.Error("The random source of an agent depends on the other agents")
+	}
+}
+
+// worlds built at once don't share their clocks
+func TestScenario_BuildClock(t *testing.T) {
+	worlds := make(chan *World, 2)
+	for _, speedup := range []float64{0, 600} {
+		go func(speedup float64) {
+			s := Scenario{Speedup: speedup, Stations: []StationSpec{{Name: "s1"}}}
+			w, err := s.Build()
+			if err != nil {
+				t.Error(err)
+			}
+			worlds <- w
+		}(speedup)
+	}
+	for k := 0; k < 2; k++ {
+		if w := <-worlds; w != nil && w.Stations["s1"].reasoner.clock != w.Clock {
+			t.Errorf("Station built with a clock other than the one of its world")
+		}
+	}
+}
+
+func TestScenario_BuildDistance(t *testing.T) {
+	s := Scenario{Distance: &DistanceSpec{Metric: metricManhattan}, Stations: []StationSpec{{Name: "s1"}}}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := w.Stations["s1"].reasoner.distances; d != (Manhattan{}) {
+		t.Errorf("Expected manhattan distances, got %T", d)
+	}
+	// the distances of a world don't outlive it
+	s.Distance = nil
+	if w, err = s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if d := w.Stations["s1"].reasoner.distances; d != (Haversine{}) {
+		t.Errorf("Expected haversine distances, got %T", d)
+	}
+}
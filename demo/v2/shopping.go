@@ -0,0 +1,89 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mikelsr/bspl"
+)
+
+// ShoppingStrategy is how a person chooses among the bikes offered
+// by every renter
+type ShoppingStrategy struct {
+	// Deadline to collect offers after requesting bikes, in wall time
+	// as it bounds the time the messages take
+	Deadline time.Duration
+	// DistanceCost is the price a meter from the person to the station
+	// of a bike is worth
+	DistanceCost float64
+}
+
+// defaultShopping waits as long as for any other answer and accepts
+// paying 0.01 more for a station 100 meters nearer, so that a station
+// a kilometer away costs 0.1 more, about the prices of the renters
+var defaultShopping = ShoppingStrategy{Deadline: timeout, DistanceCost: 0.0001}
+
+// rentalOffer is a bike offered by a renter
+type rentalOffer struct {
+	rental  bspl.Instance
+	price   float64
+	station stationInfo
+}
+
+// rank the offers from best to worst given the coordinates of the
+// person and the distances measured by d, nearer stations break ties.
+// The offers at stations with no way from the person are left apart.
+func (s ShoppingStrategy) rank(offers []rentalOffer, c Coords, d DistanceProvider) (ranked, unreachable []rentalOffer) {
+	type scored struct {
+		offer    rentalOffer
+		distance float64
+	}
+	candidates := make([]scored, 0, len(offers))
+	for _, o := range offers {
+		distance := d.Distance(c, o.station.coords)
+		if !reachable(distance) {
+			unreachable = append(unreachable, o)
+			continue
+		}
+		candidates = append(candidates, scored{offer: o, distance: distance})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si := candidates[i].offer.price + s.DistanceCost*candidates[i].distance
+		sj := candidates[j].offer.price + s.DistanceCost*candidates[j].distance
+		if si != sj {
+			return si < sj
+		}
+		return candidates[i].distance < candidates[j].distance
+	})
+	ranked = make([]rentalOffer, len(candidates))
+	for k, candidate := range candidates {
+		ranked[k] = candidate.offer
+	}
+	return ranked, unreachable
+}
+
+// ShoppingSpec configures a shopping strategy
+type ShoppingSpec struct {
+	// Deadline to collect offers, e.g. "500ms"
+	Deadline     string  `json:"deadline"`
+	DistanceCost float64 `json:"distanceCost"`
+}
+
+// NewStrategy builds the shopping strategy described by the spec
+func (s ShoppingSpec) NewStrategy() (ShoppingStrategy, error) {
+	strategy := ShoppingStrategy{Deadline: defaultShopping.Deadline, DistanceCost: s.DistanceCost}
+	if s.DistanceCost < 0 {
+		return strategy, errors.New("The distance cost can't be negative")
+	}
+	if s.Deadline == "" {
+		return strategy, nil
+	}
+	deadline, err := time.ParseDuration(s.Deadline)
+	if err != nil || deadline <= 0 {
+		return strategy, fmt.Errorf("Invalid deadline: '%s'", s.Deadline)
+	}
+	strategy.Deadline = deadline
+	return strategy, nil
+}
@@ -0,0 +1,59 @@
+package v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShoppingStrategy_rank(t *testing.T) {
+	c := Coords{Lat: 0, Lon: 0}
+	cheap := rentalOffer{price: 0.01, station: stationInfo{id: "cheap", coords: Coords{Lat: 0.0004, Lon: 0.0003}}}
+	near := rentalOffer{price: 0.02, station: stationInfo{id: "near", coords: Coords{Lat: 0.00004, Lon: 0.00003}}}
+	tie := rentalOffer{price: 0.02, station: stationInfo{id: "tie", coords: Coords{Lat: 0.00008, Lon: 0.00006}}}
+
+	tests := []struct {
+		distanceCost float64
+		expected     []string
+	}{
+		{0, []string{"cheap", "near", "tie"}},
+		{0.001, []string{"near", "tie", "cheap"}},
+	}
+	for _, test := range tests {
+		offers, _ := ShoppingStrategy{DistanceCost: test.distanceCost}.rank([]rentalOffer{tie, cheap, near}, c, Euclidean{})
+		for k, id := range test.expected {
+			if offers[k].station.id != id {
+				t.Errorf("Distance cost %v: expected %s at %d, found %s",
+					test.distanceCost, id, k, offers[k].station.id)
+			}
+		}
+	}
+}
+
+func TestShoppingStrategy_rankUnreachable(t *testing.T) {
+	n := NewStreetNetwork()
+	n.AddStreet([]Coords{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 0.001}}, false)
+	n.AddStreet([]Coords{{Lat: 0.01, Lon: 0}, {Lat: 0.01, Lon: 0.001}}, false)
+	near := rentalOffer{price: 0.02, station: stationInfo{id: "near", coords: Coords{Lat: 0, Lon: 0.001}}}
+	island := rentalOffer{price: 0.01, station: stationInfo{id: "island", coords: Coords{Lat: 0.01, Lon: 0.001}}}
+
+	ranked, unreachable := defaultShopping.rank([]rentalOffer{island, near}, Coords{Lat: 0, Lon: 0}, n)
+	if len(ranked) != 1 || ranked[0].station.id != "near" {
+		t.Errorf("Expected only the reachable offer ranked, got %v", ranked)
+	}
+	if len(unreachable) != 1 || unreachable[0].station.id != "island" {
+		t.Errorf("Expected the offer across the streets apart, got %v", unreachable)
+	}
+}
+
+func TestShoppingSpec_NewStrategy(t *testing.T) {
+	s, err := ShoppingSpec{Deadline: "500ms", DistanceCost: 0.01}.NewStrategy()
+	if err != nil || s.Deadline != 500*time.Millisecond || s.DistanceCost != 0.01 {
+		t.Errorf("Unexpected strategy %+v, error: %v", s, err)
+	}
+	if s, _ := (ShoppingSpec{}).NewStrategy(); s.Deadline != defaultShopping.Deadline {
+		t.Errorf("Expected the default deadline, got %s", s.Deadline)
+	}
+	if _, err := (ShoppingSpec{Deadline: "soon"}).NewStrategy(); err == nil {
+		t.Error("Invalid deadline accepted")
+	}
+}
@@ -1,9 +1,18 @@
 package v2
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
 	"github.com/mikelsr/nahs"
+	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 // Station that charges bikes
@@ -13,12 +22,12 @@ type Station struct {
 }
 
 // NewStation is the default constructor for Station
-func NewStation(c Coords) Station {
+func NewStation(o AgentOptions, c Coords) Station {
 	s := Station{}
 	// the cycle of life
-	s.reasoner = newStationReasoner(c)
+	s.reasoner = newStationReasoner(o, c)
 	//p.Node = nahs.NewNode(p.reasoner)
-	s.Node = net.LocalNode(s.reasoner)
+	s.Node = net.LocalNode(s.reasoner, NodeOptions...)
 	s.reasoner.Node = s.Node
 	logger.Debugf("Created station with ID %s (%s)", shortID(s.ID()), s.ID())
 	return s
@@ -29,85 +38,228 @@ func (s Station) ID() string {
 	return s.Node.ID().Pretty()
 }
 
+// Instances of a protocol enacted by the station in any of the given
+// states, or the open ones if no state is given
+func (s Station) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return s.reasoner.InstancesIn(p, states...)
+}
+
 // Coords of the station
 func (s Station) Coords() Coords {
 	return s.reasoner.coords
 }
 
+// SetDocks sets the number of dock slots of the station, unlimited if 0.
+// Bikes can't dock at a station with every slot taken.
+func (s Station) SetDocks(docks int) {
+	s.reasoner.bikes.setCapacity(docks)
+}
+
+// Register the station with a locator, along with the ID of the renter
+// controlling it, so that it's found by the searches of the locator
+func (s Station) Register(locatorID, operator string) error {
+	return s.reasoner.register(locatorID, operator)
+}
+
 // Bikes retunrs a list of bikes docked at a station
 /*func (s Station) Bikes() []*Bike {
 	return s.reasoner.bikes
 }
 */
 
-// DockBike docks a bike to a station
-func (s Station) DockBike(b *Bike) {
-	s.reasoner.dockBike(b)
-}
-
 // ReleaseBike removes a bike from a station
 /*func (s Station) ReleaseBike(b *Bike) {
 	s.reasoner.releaseBike(b)
 }*/
 
 type stationReasoner struct {
-	Node *nahs.Node
-
-	offeredServices  map[string]bspl.Protocol
-	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+	baseReasoner
 
 	coords Coords
-	bikes  bikeStorage
+	bikes  *bikeStorage
+	// registrations waiting for the locator to answer, guarded by mutex
+	registrations map[string]chan string
 }
 
-func newStationReasoner(c Coords) *stationReasoner {
-	s := stationReasoner{}
+func newStationReasoner(o AgentOptions, c Coords) *stationReasoner {
+	s := &stationReasoner{baseReasoner: newBaseReasoner(o)}
+	// dock bikes
+	s.offer(bikeStorageProtocol, s.registerBikeStorage, nil)
+	// let renters and transports check and change the inventory
+	s.offer(stationInventoryProtocol, s.registerStationInventory, nil)
+	// register with locators
+	s.consume(stationRegistryProtocol, s.instantiateStationRegistry, s.updateStationRegistry)
 	s.coords = c
 	s.bikes = newBikeStorage()
-	return &s
+	s.registrations = make(map[string]chan string)
+	return s
 }
 
-// DropInstance cancels an Instance for whatever motive
-func (sr *stationReasoner) DropInstance(instanceKey string, motive string) error {
+func (sr *stationReasoner) registerBikeStorage(i bspl.Instance) error {
+	bikeID := i.Roles()["Bike"]
+	if _, err := typed(i).RolePeer("Bike"); err != nil {
+		return sr.reject(i, err)
+	}
+	if err := sr.bikes.dock(bikeID, i.Key()); err != nil {
+		return sr.reject(i, err)
+	}
+	logger.Infof("[%s] Bike %s docked", shortID(sr.Node.ID()), shortID(bikeID))
 	return nil
 }
 
-// GetInstance returns an Instance given the instance key
-func (sr *stationReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	return nil, false
+func (sr *stationReasoner) registerStationInventory(i bspl.Instance) error {
+	operation := i.GetValue("operation")
+	argument := i.GetValue("argument")
+	result := inventoryOK
+	bikeID := ""
+	switch operation {
+	case inventoryQuery:
+	case inventoryReserve:
+		ttl := defaultReservationTTL
+		if argument != noArgument {
+			var err error
+			if ttl, err = time.ParseDuration(argument); err != nil || ttl <= 0 {
+				result = fmt.Sprintf("invalid reservation TTL '%s'", argument)
+				break
+			}
+		}
+		if bikeID = sr.reserveBike(ttl); bikeID == "" {
+			result = "no bikes available"
+		}
+	case inventoryCancel:
+		if !sr.bikes.cancel(argument) {
+			result = fmt.Sprintf("bike '%s' not reserved", argument)
+		}
+	case inventoryRelease:
+		var rentalID string
+		var err error
+		if bikeID, rentalID, err = splitReleaseArgument(argument); err != nil {
+			result = err.Error()
+		} else if err = sr.releaseBike(bikeID, rentalID); err != nil {
+			result = err.Error()
+		}
+	default:
+		result = fmt.Sprintf("unknown operation '%s'", operation)
+	}
+	logger.Debugf("[%s] Inventory %s from %s: %s", shortID(sr.Node.ID()),
+		operation, shortID(i.Roles()["Client"]), result)
+	i.SetValue("result", result)
+	i.SetValue("bikeID", bikeID)
+	typed(i).SetInt("available", sr.bikes.availableCount())
+	typed(i).SetCoords("coordinates", sr.coords)
+	typed(i).SetInt("docks", sr.bikes.freeDocks())
+	go sendEvent(events.MakeUpdateEvent(i), i, sr.Node)
+	sr.complete(i.Key())
+	return nil
 }
 
-// All instances of a Protocol
-func (sr *stationReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	return nil
+// reserveBike so that it can't be reserved again until it is released,
+// cancelled or expired, returns an empty string if there are no bikes
+// available. Reservations expire some time after their TTL so that the
+// reserver cancels them if still running.
+func (sr *stationReasoner) reserveBike(ttl time.Duration) string {
+	hold := ttl + reservationGrace
+	expiry := sr.clock.Now().Add(hold)
+	bikeID := sr.bikes.reserveBike(expiry)
+	if bikeID != "" {
+		go sr.expireReservation(bikeID, expiry, hold)
+	}
+	return bikeID
 }
 
-// Instantiate a protocol. Check if the assigned role is a role
-// the reasoner is willing to play.
-func (sr *stationReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
-	return nil, nil
+// expireReservation returns a reserved bike to the available ones
+// once its reservation expires
+func (sr *stationReasoner) expireReservation(bikeID string, expiry time.Time, hold time.Duration) {
+	<-sr.clock.After(hold)
+	if sr.bikes.expire(bikeID, expiry) {
+		logger.Infof("[%s] Reservation of bike %s expired", shortID(sr.Node.ID()), shortID(bikeID))
+	}
 }
 
-// RegisterInstance registers an Instance created by another Reasoner
-func (sr *stationReasoner) RegisterInstance(i bspl.Instance) error {
+// releaseBike undocks a reserved bike and sends the rental ID to it
+func (sr *stationReasoner) releaseBike(bikeID, rentalID string) error {
+	key, found := sr.bikes.undock(bikeID)
+	if !found {
+		return fmt.Errorf("Bike '%s' not reserved", bikeID)
+	}
+	i, found := sr.GetInstance(key)
+	if !found {
+		return fmt.Errorf("Instance '%s' not found", key)
+	}
+	i.SetValue("rentalID", rentalID)
+	go sendEvent(events.MakeUpdateEvent(i), i, sr.Node)
+	sr.complete(i.Key())
+	logger.Infof("[%s] Bike %s released", shortID(sr.Node.ID()), shortID(bikeID))
 	return nil
 }
 
-// UpdateInstance updates an instance with a newer version of itself
-// as long as a valid run from one to the other.
-func (sr *stationReasoner) UpdateInstance(newVersion bspl.Instance) error {
-	return nil
+func (sr *stationReasoner) instantiateStationRegistry(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
+	params, err := requireValues(values, "in operator")
+	if err != nil {
+		return nil, err
+	}
+	i := imp.NewInstance(stationRegistryProtocol, roles)
+	i.SetValue("ID", uuid.New().String())
+	i.SetValue("operator", params["in operator"])
+	return i, nil
 }
 
-func (sr *stationReasoner) dockBike(b *Bike) {
-	if !sr.bikes.has(b.ID()) {
-		logger.Infof("[%s] Bike %s docked", shortID(sr.Node.ID()), shortID(b.ID()))
-		sr.bikes.dock(b)
+func (sr *stationReasoner) updateStationRegistry(j bspl.Instance, actions []bspl.Action) error {
+	if len(actions) != 1 || actions[0].Name != "ack" {
+		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
 	}
+	sr.mutex.Lock()
+	result, found := sr.registrations[j.Key()]
+	delete(sr.registrations, j.Key())
+	sr.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No pending registration for instance '%s'", j.Key())
+	}
+	sr.complete(j.Key())
+	result <- j.GetValue("rID")
+	return nil
 }
 
-func (sr *stationReasoner) releaseBike(b *Bike) {
-	sr.bikes.releaseBike(b.ID())
+// register the station with a locator and wait for its answer
+func (sr *stationReasoner) register(locatorID, operator string) error {
+	locator, err := peer.IDB58Decode(locatorID)
+	if err != nil {
+		return fmt.Errorf("Invalid locator ID: '%s'", locatorID)
+	}
+	if operator == "" {
+		operator = noOperator
+	}
+	roles := bspl.Roles{"Station": sr.Node.ID().Pretty(), "Locator": locatorID}
+	i, err := sr.Instantiate(stationRegistryProtocol, roles, bspl.Values{"in operator": operator})
+	if err != nil {
+		return err
+	}
+	sr.Node.SetInstancePeer(i.Key(), locator)
+	// the answer may arrive before the event is acknowledged
+	result := make(chan string, 1)
+	sr.mutex.Lock()
+	sr.registrations[i.Key()] = result
+	sr.mutex.Unlock()
+	ok, err := sr.Node.SendEvent(locator, events.MakeNewEvent(i))
+	if err == nil && !ok {
+		err = fmt.Errorf("Locator '%s' rejected the registration", locatorID)
+	}
+	if err == nil {
+		// network round trips are measured in real time whatever the clock
+		select {
+		case rID := <-result:
+			if rID == "accept" {
+				logger.Infof("[%s] Registered with locator %s", shortID(sr.Node.ID()), shortID(locatorID))
+				return nil
+			}
+			return fmt.Errorf("Locator '%s' rejected the registration", locatorID)
+		case <-time.After(timeout):
+			err = fmt.Errorf("Locator '%s' didn't answer", locatorID)
+		}
+	}
+	sr.mutex.Lock()
+	delete(sr.registrations, i.Key())
+	sr.mutex.Unlock()
+	sr.DropInstance(i.Key(), "Registration not answered")
+	return err
 }
@@ -3,9 +3,8 @@ package v2
 import (
 	"errors"
 	"fmt"
-	"math"
-	"strconv"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -14,6 +13,8 @@ import (
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 // Transport of bikes
@@ -22,258 +23,427 @@ type Transport struct {
 	Node     *nahs.Node
 	coords   Coords
 	// the transport already knows about stations
-	stations []*Station
+	stations []string
 }
 
-// NewTransport is the default constructor for Transport
-func NewTransport(stations ...*Station) Transport {
+// NewTransport is the default constructor for Transport, given the IDs
+// of the stations it serves
+func NewTransport(o AgentOptions, stations ...string) Transport {
 	t := Transport{}
 	t.stations = stations
 	// the cycle of life
-	t.reasoner = newTransportReasoner(stations...)
+	t.reasoner = newTransportReasoner(o, stations...)
 	//p.Node = nahs.NewNode(p.reasoner)
-	t.Node = net.LocalNode(t.reasoner)
+	t.Node = net.LocalNode(t.reasoner, NodeOptions...)
 	t.reasoner.Node = t.Node
+	go t.reasoner.drive()
 	logger.Debugf("\tCreated transport with ID %s (%s)", shortID(t.ID()), t.Node.ID())
 	return t
 }
 
+// SetVehicle sets the number of bikes the transport carries at once
+// and its speed in meters per second, zero values are ignored
+func (t Transport) SetVehicle(capacity int, speed float64) {
+	t.reasoner.mutex.Lock()
+	defer t.reasoner.mutex.Unlock()
+	if capacity > 0 {
+		t.reasoner.vehicle.capacity = capacity
+	}
+	if speed > 0 {
+		t.reasoner.vehicle.speed = speed
+	}
+}
+
+// SetPosition sets where the transport is
+func (t Transport) SetPosition(c Coords) {
+	t.reasoner.mutex.Lock()
+	defer t.reasoner.mutex.Unlock()
+	t.reasoner.vehicle.position = c
+}
+
 // ID of the transport
 func (t Transport) ID() string {
 	return t.Node.ID().Pretty()
 }
 
+// Instances of a protocol enacted by the transport in any of the given
+// states, or the open ones if no state is given
+func (t Transport) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return t.reasoner.InstancesIn(p, states...)
+}
+
 type transportReasoner struct {
-	Node *nahs.Node
+	baseReasoner
 
-	offeredServices  map[string]bspl.Protocol
-	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+	inventory *inventoryClient
 
-	coords   Coords
-	stations []*Station
-	speed    int
+	stations []string
+	// vehicle and the hauls accepted and not started yet, guarded by mutex
+	vehicle vehicle
+	queue   []*haul
+	// wake the driver of the vehicle to plan its trips again
+	wake chan struct{}
 }
 
-func newTransportReasoner(stations ...*Station) *transportReasoner {
-	t := &transportReasoner{}
-	// initialize maps
-	t.openInstances = make(map[string]bspl.Instance)
-	t.droppedInstances = make(map[string]bspl.Instance)
-	t.consumedServices = map[string]bspl.Protocol{
-		bikeRideProtocol.Key(): bikeRideProtocol,
-	}
-	t.offeredServices = map[string]bspl.Protocol{
-		bikeTransportProtocol.Key(): bikeTransportProtocol,
-	}
-	t.coords = Coords{}
+// defaultVehicle carries 10 bikes, 100 meters per second
+var defaultVehicle = vehicle{capacity: 10, speed: 100}
+
+func newTransportReasoner(o AgentOptions, stations ...string) *transportReasoner {
+	t := &transportReasoner{baseReasoner: newBaseReasoner(o)}
+	// take bikes from and check the inventory of the stations
+	t.inventory = newInventoryClient(&t.baseReasoner)
+	// ride bikes to move them, transport bikes
+	t.consume(bikeRideProtocol, t.instantiateBikeRide, nil)
+	t.offer(bikeTransportProtocol, t.registerBikeTransport, nil)
 	t.stations = stations
-	t.speed = 1
+	t.vehicle = defaultVehicle
+	t.vehicle.distances = t.distances
+	t.queue = make([]*haul, 0)
+	t.wake = make(chan struct{}, 1)
 	return t
 }
 
-// DropInstance cancels an Instance for whatever motive
-func (tr *transportReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := tr.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
+func (tr *transportReasoner) instantiateBikeRide(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
+	params, err := requireValues(values, "in rentalID")
+	if err != nil {
+		return nil, err
 	}
-	tr.droppedInstances[instanceKey] = instance
-	delete(tr.openInstances, instanceKey)
-	return nil
+	i := imp.NewInstance(bikeRideProtocol, roles)
+	i.SetValue("ID", uuid.New().String())
+	i.SetValue("rentalID", params["in rentalID"])
+	return i, nil
 }
 
-// GetInstance returns an Instance given the instance key
-func (tr *transportReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	instance, found := tr.openInstances[instanceKey]
-	return instance, found
+func (tr *transportReasoner) registerBikeTransport(i bspl.Instance) error {
+	// check bike number
+	n, err := typed(i).Int("bikeNum")
+	if err != nil {
+		return tr.reject(i, err)
+	}
+	// look for stations
+	src, _, srcErr := tr.findStation(i.GetValue("src"))
+	dst, dstReport, dstErr := tr.findStation(i.GetValue("dst"))
+	if srcErr != nil || dstErr != nil {
+		return tr.reject(i, errors.New("One of the stations was not found"))
+	}
+	// check time
+	dt, err := typed(i).Time("datetime")
+	if err != nil {
+		return tr.reject(i, err)
+	}
+	// accept the haul only if it and every haul accepted before can
+	// still be carried on time and the bikes fit at the destination
+	h := &haul{key: i.Key(), src: src, dst: dst, bikes: n, due: dt}
+	tr.mutex.Lock()
+	_, feasible := tr.vehicle.plan(append(tr.queue[:len(tr.queue):len(tr.queue)], h), tr.clock.Now())
+	feasible = feasible && dstReport.canDock(tr.queuedTo(dst.id)+n)
+	if feasible {
+		tr.queue = append(tr.queue, h)
+	}
+	tr.mutex.Unlock()
+	if !feasible {
+		logger.Infof("[%s] Rejecting transport of %d bikes to %s by %v", shortID(tr.Node.ID()),
+			n, shortID(dst.id), dt)
+		i.SetValue("rID", "reject")
+		go sendEvent(events.MakeUpdateEvent(i), i, tr.Node)
+		tr.complete(i.Key())
+		return nil
+	}
+	i.SetValue("rID", "accept")
+	go sendEvent(events.MakeUpdateEvent(i), i, tr.Node)
+	tr.signal()
+	return nil
 }
 
-// All instances of a Protocol
-func (tr *transportReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	instances := make([]bspl.Instance, len(tr.openInstances))
-	i := 0
-	for _, v := range tr.openInstances {
-		instances[i] = v
-		i++
+// signal the driver that the hauls changed
+func (tr *transportReasoner) signal() {
+	select {
+	case tr.wake <- struct{}{}:
+	default:
 	}
-	return instances
 }
 
-func (tr *transportReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
-	if _, consumed := tr.consumedServices[p.Key()]; !consumed {
-		return nil, fmt.Errorf("Protocol '%s' not supported by this Node", p.Key())
-	}
-	switch p.Key() {
-	case bikeRideProtocol.Key():
-		return tr.instantiateBikeRide(roles, ins)
+// drive the vehicle: plan the trips of the hauls accepted, wait until
+// the first one has to leave so that later hauls can join it, and
+// make it
+func (tr *transportReasoner) drive() {
+	for {
+		tr.mutex.Lock()
+		trips, _ := tr.vehicle.plan(tr.queue, tr.clock.Now())
+		tr.mutex.Unlock()
+		if len(trips) == 0 {
+			<-tr.wake
+			continue
+		}
+		if wait := slack(trips); wait > 0 {
+			select {
+			case <-tr.clock.After(wait):
+			case <-tr.wake:
+				continue
+			}
+		}
+		// plan again in case a haul arrived meanwhile
+		tr.mutex.Lock()
+		now := tr.clock.Now()
+		trips, _ = tr.vehicle.plan(tr.queue, now)
+		next := trips[0]
+		from := tr.vehicle.position
+		tr.queue = remainingHauls(tr.queue, next.hauls)
+		if next.unreachable {
+			// the hauls were reachable when accepted, but not from
+			// where the vehicle ended up
+			tr.mutex.Unlock()
+			for _, h := range next.hauls {
+				h.failure = fmt.Sprintf("No way from %s to %s", h.src.id, h.dst.id)
+				tr.report(h)
+			}
+			continue
+		}
+		tr.vehicle.position = next.stops[len(next.stops)-1].station.coords
+		tr.vehicle.free = next.end()
+		tr.mutex.Unlock()
+		tr.makeTrip(from, next)
 	}
-	return nil, fmt.Errorf("Unkown protocol '%s'", p.Key())
 }
 
-func (tr *transportReasoner) instantiateBikeRide(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
-	id := uuid.New().String()
-	params := make(map[string]string)
-	required := []string{"in rentalID"}
-	for _, r := range required {
-		v, found := values[r]
+// remainingHauls of a queue once some of them are carried
+func remainingHauls(queue, carried []*haul) []*haul {
+	rest := make([]*haul, 0, len(queue))
+	for _, h := range queue {
+		found := false
+		for _, c := range carried {
+			if h == c {
+				found = true
+				break
+			}
+		}
 		if !found {
-			return nil, fmt.Errorf("Missing parameter: '%s'", r)
+			rest = append(rest, h)
 		}
-		params[r] = v
 	}
-	i := imp.NewInstance(bikeRideProtocol, roles)
-	i.SetValue("ID", id)
-	i.SetValue("rentalID", params["in rentalID"])
-	tr.openInstances[i.Key()] = i
-	return i, nil
+	return rest
 }
 
-func (tr *transportReasoner) RegisterInstance(i bspl.Instance) error {
-	if _, found := tr.openInstances[i.Key()]; found {
-		return fmt.Errorf("Instance '%s' already existed", i.Key())
-	}
-	// TODO: verify who sends the message and assert the role ID is correct.
-	// This should be done in the library, not the demo.
-	if len(i.Roles()) < 2 {
-		return fmt.Errorf("Missing roles for instance '%s'", i.Key())
+// makeTrip goes through the stops of a trip picking up and dropping the
+// bikes of its hauls, the result of each haul is reported once its
+// bikes are dropped
+func (tr *transportReasoner) makeTrip(from Coords, t *trip) {
+	logger.Debugf("[%s] Leaving on a trip of %d stops with %d bikes", shortID(tr.Node.ID()),
+		len(t.stops), t.load())
+	tr.mutex.Lock()
+	v := tr.vehicle
+	tr.mutex.Unlock()
+	position := from
+	for _, s := range t.stops {
+		// the trip was planned, so there's a way to every stop
+		d, _ := v.travelTime(position, s.station.coords)
+		tr.clock.Sleep(d)
+		position = s.station.coords
+		logger.Debugf("[%s] Arrived at %s", shortID(tr.Node.ID()), shortID(s.station.id))
+		if s.pickup {
+			tr.pickBikes(s.haul)
+		} else {
+			tr.dropBikes(s.haul)
+		}
 	}
-	found := false
-	for _, proto := range tr.offeredServices {
-		if proto.Key() == i.Protocol().Key() {
-			found = true
+	// the bikes that didn't fit at their destination are still in
+	// the vehicle
+	rehomed := false
+	for _, h := range t.hauls {
+		if h.dropped < len(h.picked) {
+			position = tr.rehomeBikes(v, position, h)
+			rehomed = true
 		}
 	}
-	if !found {
-		return fmt.Errorf("Protocol '%s' not offered", i.Protocol().Key())
+	if rehomed {
+		tr.mutex.Lock()
+		tr.vehicle.position = position
+		if now := tr.clock.Now(); tr.vehicle.free.Before(now) {
+			tr.vehicle.free = now
+		}
+		tr.mutex.Unlock()
 	}
-	tr.openInstances[i.Key()] = i
+}
 
-	var err error
-	switch i.Protocol().Key() {
-	case bikeTransportProtocol.Key():
-		err = tr.registerBikeTransport(i)
-	}
+// pickBikes of a haul at its source station
+func (tr *transportReasoner) pickBikes(h *haul) {
+	report, err := tr.inventory.query(h.src.id)
 	if err != nil {
-		logger.Errorf("[%s] %s", shortID(tr.Node.ID()), err)
+		h.failure = err.Error()
+		return
 	}
-	return err
-}
-
-func (tr *transportReasoner) registerBikeTransport(i bspl.Instance) error {
-	// check bike number
-	bikeNum := i.GetValue("bikeNum")
-	n, err := strconv.ParseInt(bikeNum, 10, 64)
-	if err != nil || n <= 0 {
-		errMsg := fmt.Sprintf("Invalid bike number %s.", bikeNum)
-		go sendEvent(events.MakeDropEvent(i.Key(), errMsg), i, tr.Node)
-		return errors.New(errMsg)
+	if report.available < h.bikes {
+		h.failure = fmt.Sprintf("%d bikes were requested but only %d were available", h.bikes, report.available)
 	}
-	// look for stations
-	srcStr := i.GetValue("src")
-	dstStr := i.GetValue("dst")
-	var src, dst *Station
-	for _, s := range tr.stations {
-		if srcStr == s.ID() {
-			src = s
+	// bikes are ridden under the ID of the transport
+	instance, found := tr.GetInstance(h.key)
+	if !found {
+		h.failure = fmt.Sprintf("Instance with key '%s' not found", h.key)
+		return
+	}
+	rentalID := instance.GetValue("ID")
+	for i := 0; i < h.bikes; i++ {
+		report, err := tr.inventory.reserve(h.src.id, defaultReservationTTL)
+		bikeID := report.bikeID
+		if err != nil {
+			logger.Errorf("[%s] Only %d bikes left at %s: %s", shortID(tr.Node.ID()), i, shortID(h.src.id), err)
+			break
 		}
-		if dstStr == s.ID() {
-			dst = s
+		if err := tr.inventory.release(h.src.id, bikeID, rentalID); err != nil {
+			logger.Errorf("[%s] %s", shortID(tr.Node.ID()), err)
+			continue
 		}
+		ride := tr.pickBike(bikeID, rentalID)
+		h.rides = append(h.rides, ride.Key())
+		h.picked = append(h.picked, bikeID)
+		logger.Debugf("[%s] Picked up bike %s from %s", shortID(tr.Node.ID()), shortID(bikeID), shortID(h.src.id))
 	}
-	if src == nil || dst == nil {
-		errMsg := "One of the stations was not found."
-		go sendEvent(events.MakeDropEvent(i.Key(), errMsg), i, tr.Node)
-		return errors.New(errMsg)
-	}
-	// check time
-	datetime := i.GetValue("datetime")
-	dt, err := time.Parse(time.RFC3339, datetime)
-	if err != nil {
-		errMsg := fmt.Sprintf("Invalid datetime: %s", datetime)
-		go sendEvent(events.MakeDropEvent(i.Key(), errMsg), i, tr.Node)
-		return errors.New(errMsg)
+	if len(h.picked) < h.bikes && h.failure == "" {
+		h.failure = fmt.Sprintf("Only %d of %d bikes could be picked up", len(h.picked), h.bikes)
 	}
-	tr.openInstances[i.Key()] = i
-	// Arbitrary time estimation
-	estimatedTime := time.Duration(
-		math.Sqrt(math.Pow(src.Coords().X-dst.Coords().X, 2)+math.Pow(src.Coords().Y-dst.Coords().Y, 2))/100,
-	) * time.Second
-	// Time libraries are always magical
-	dt = dt.Add(-estimatedTime)
-	// dt now contains the estimated hour the bikes should be picked up to arrive at the requested time
-	if dt.Before(time.Now()) {
-		errMsg := fmt.Sprintf("[%s] Not enough time to transport destination, at least %f seconds required.",
-			shortID(tr.Node.ID()), estimatedTime.Seconds())
-		go sendEvent(events.MakeDropEvent(i.Key(), errMsg), i, tr.Node)
-		return errors.New(errMsg)
-	}
-	renter := tr.Node.OpenInstances[i.Key()]
-	go tr.scheduleTransport(src, dst, n, time.Until(dt), estimatedTime, renter.Pretty(), i.Key())
-	i.SetValue("rID", "accept")
-	go sendEvent(events.MakeUpdateEvent(i), i, tr.Node)
-	return nil
 }
 
-func (tr *transportReasoner) UpdateInstance(j bspl.Instance) error {
-	return errors.New("Transport does not expect instance updates")
+// queuedTo is the number of bikes of the hauls not started yet to a
+// station, the mutex must be held
+func (tr *transportReasoner) queuedTo(stationID string) int {
+	n := 0
+	for _, h := range tr.queue {
+		if h.dst.id == stationID {
+			n += h.bikes
+		}
+	}
+	return n
 }
 
-func (tr *transportReasoner) scheduleTransport(src, dst *Station, n int64, waitUntil, estimatedDuration time.Duration, renter, key string) {
-	select {
-	case <-time.After(waitUntil):
-		err := tr.transportBikes(src, dst, n, renter, key, estimatedDuration)
-		if err != nil {
-			logger.Errorf("[%s] Error running scheduled transport: %s", shortID(tr.Node.ID()), err)
+// dropBikes of a haul at its destination and report its result. Only
+// as many bikes as free docks are dropped, the rest stay in the vehicle
+// and the result is reported once they are rehomed.
+func (tr *transportReasoner) dropBikes(h *haul) {
+	dropped := len(h.picked)
+	report, err := tr.inventory.query(h.dst.id)
+	if err != nil {
+		logger.Errorf("[%s] %s", shortID(tr.Node.ID()), err)
+	} else if !report.canDock(dropped) {
+		dropped = report.docks
+		if h.failure == "" {
+			h.failure = fmt.Sprintf("Only %d of %d bikes could be docked at %s", dropped, len(h.picked), h.dst.id)
 		}
 	}
-	return
+	// bikes dock by themselves once dropped
+	for i, bikeID := range h.picked[:dropped] {
+		tr.dropBike(bikeID, h.dst.id, h.rides[i])
+		logger.Debugf("[%s] Dropped bike %s at %s", shortID(tr.Node.ID()), shortID(bikeID), shortID(h.dst.id))
+	}
+	h.dropped = dropped
+	if dropped < len(h.picked) {
+		return
+	}
+	tr.report(h)
 }
 
-func (tr *transportReasoner) transportBikes(src, dst *Station, n int64, renter, key string, estimatedDuration time.Duration) error {
-	// check availability of bikes
-	available := src.reasoner.bikes.available.len()
-	if int64(available) < n {
-		return fmt.Errorf("%d bikes were requested but only %d were available", available, n)
+// rehomeBikes takes the bikes of a haul that didn't fit at its
+// destination to the nearest stations served with free docks, or else
+// back to their source, closes their rides and reports the haul saying
+// where they went. Stations the vehicle can't reach are skipped.
+// Returns where the vehicle ends up.
+func (tr *transportReasoner) rehomeBikes(v vehicle, position Coords, h *haul) Coords {
+	type room struct {
+		station  stationInfo
+		docks    int
+		distance float64
 	}
-
-	// send ok to requester
-	instance := tr.openInstances[key]
-	instance.SetValue("rID", "accept")
-	go sendEvent(events.MakeUpdateEvent(instance), instance, tr.Node)
-
-	// asume location of transport is the first station
-	tr.coords = src.Coords()
-
-	keys := make([]string, n)
-	bikes := make([]*Bike, n)
-	// pick bikes
-	for i := 0; int64(i) < n; i++ {
-		b := src.reasoner.bikes.available.pop()
-		instance := tr.pickBike(b.ID(), renter)
-		keys[i] = instance.Key()
-		src.reasoner.releaseBike(b)
-		bikes[i] = b
-		logger.Debugf("[%s] Picked up bike %s from %s", shortID(tr.Node.ID()), shortID(b.ID()), shortID(src.ID()))
+	rooms := make([]room, 0, len(tr.stations))
+	for _, id := range tr.stations {
+		if id == h.dst.id {
+			continue
+		}
+		report, err := tr.inventory.query(id)
+		if err != nil || report.docks == 0 {
+			continue
+		}
+		s := stationInfo{id: id, coords: report.coords}
+		if d := tr.distances.Distance(h.dst.coords, s.coords); reachable(d) {
+			rooms = append(rooms, room{station: s, docks: report.docks, distance: d})
+		}
 	}
+	sort.SliceStable(rooms, func(i, j int) bool { return rooms[i].distance < rooms[j].distance })
+	// the source held the bikes before the trip
+	rooms = append(rooms, room{station: h.src, docks: unlimitedDocks})
 
-	// move bikes
-	logger.Debugf("[%s] Moving from %v to %v", shortID(tr.Node.ID()), src.Coords(), dst.Coords())
-	time.Sleep(estimatedDuration)
-	logger.Debugf("[%s] Moved from %v to %v", shortID(tr.Node.ID()), src.Coords(), dst.Coords())
-	tr.coords = dst.Coords()
-
-	// drop bikes
-	for i, b := range bikes {
-		dst.reasoner.dockBike(b)
-		tr.dropBike(b.ID(), dst.ID(), keys[i])
-		logger.Debugf("[%s] Dropped bike %s at %s", shortID(tr.Node.ID()), shortID(b.ID()), shortID(dst.ID()))
+	left, rides := h.picked[h.dropped:], h.rides[h.dropped:]
+	places := make([]string, 0)
+	for _, r := range rooms {
+		if len(left) == 0 {
+			break
+		}
+		n := len(left)
+		if r.docks != unlimitedDocks && r.docks < n {
+			n = r.docks
+		}
+		d, ok := v.travelTime(position, r.station.coords)
+		if !ok {
+			continue
+		}
+		tr.clock.Sleep(d)
+		position = r.station.coords
+		for i, bikeID := range left[:n] {
+			tr.dropBike(bikeID, r.station.id, rides[i])
+			logger.Debugf("[%s] Dropped bike %s at %s instead of %s", shortID(tr.Node.ID()),
+				shortID(bikeID), shortID(r.station.id), shortID(h.dst.id))
+		}
+		places = append(places, fmt.Sprintf("%d taken to %s", n, r.station.id))
+		left, rides = left[n:], rides[n:]
 	}
+	if len(left) > 0 {
+		logger.Errorf("[%s] No way to a station for %d bikes", shortID(tr.Node.ID()), len(left))
+		places = append(places, fmt.Sprintf("%d left in the vehicle", len(left)))
+	}
+	h.failure = fmt.Sprintf("%s, %s", h.failure, strings.Join(places, ", "))
+	tr.report(h)
+	return position
+}
 
+// report the result of a haul once its bikes are dropped
+func (tr *transportReasoner) report(h *haul) {
+	instance, found := tr.GetInstance(h.key)
+	if !found {
+		logger.Errorf("[%s] Instance with key '%s' not found", shortID(tr.Node.ID()), h.key)
+		return
+	}
+	if h.failure != "" {
+		tr.fail(instance, h.dropped, h.failure)
+		return
+	}
 	instance.SetValue("result", "success")
+	typed(instance).SetInt("movedNum", h.dropped)
 	go sendEvent(events.MakeUpdateEvent(instance), instance, tr.Node)
-	return nil
+	tr.complete(instance.Key())
+}
+
+// fail reports to the requester that a transport couldn't be completed
+// and the number of bikes moved anyway
+func (tr *transportReasoner) fail(i bspl.Instance, moved int, reason string) {
+	i.SetValue("result", "failure")
+	typed(i).SetInt("movedNum", moved)
+	i.SetValue("reason", reason)
+	go sendEvent(events.MakeUpdateEvent(i), i, tr.Node)
+	tr.complete(i.Key())
+}
+
+// findStation among the stations served by the transport, along with
+// its inventory
+func (tr *transportReasoner) findStation(stationID string) (stationInfo, inventoryReport, error) {
+	for _, s := range tr.stations {
+		if s != stationID {
+			continue
+		}
+		report, err := tr.inventory.query(stationID)
+		if err != nil {
+			return stationInfo{}, report, err
+		}
+		return stationInfo{id: stationID, coords: report.coords}, report, nil
+	}
+	return stationInfo{}, inventoryReport{}, fmt.Errorf("Station '%s' not found", stationID)
 }
 
 func (tr *transportReasoner) pickBike(bikeID, rentalID string) bspl.Instance {
@@ -286,17 +456,19 @@ func (tr *transportReasoner) pickBike(bikeID, rentalID string) bspl.Instance {
 	roles := bspl.Roles{"Rider": tr.Node.ID().Pretty(), "Bike": bikeID}
 	inputs := bspl.Values{"in rentalID": rentalID}
 	i, _ := tr.Instantiate(bikeRideProtocol, roles, inputs)
-	tr.Node.OpenInstances[i.Key()], _ = peer.IDB58Decode(bikeID)
+	bike, _ := peer.IDB58Decode(bikeID)
+	tr.Node.SetInstancePeer(i.Key(), bike)
 	go sendEvent(events.MakeNewEvent(i), i, tr.Node)
 	return i
 }
 
 func (tr *transportReasoner) dropBike(bikeID, stationID string, key string) {
-	i, found := tr.openInstances[key]
+	i, found := tr.GetInstance(key)
 	if !found {
-		logger.Errorf("[%s] Instance with key '%s' not found", shortID(tr.Node.ID()), i.Key())
+		logger.Errorf("[%s] Instance with key '%s' not found", shortID(tr.Node.ID()), key)
 		return
 	}
 	i.SetValue("dropStation", stationID)
 	go sendEvent((events.MakeUpdateEvent(i)), i, tr.Node)
+	tr.complete(i.Key())
 }
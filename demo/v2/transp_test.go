@@ -0,0 +1,47 @@
+package v2
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
+)
+
+func TestTransport_rehomeBikes(t *testing.T) {
+	s := Scenario{
+		Speedup: 1,
+		Start:   time.Date(2020, 6, 18, 8, 0, 0, 0, time.UTC),
+		Stations: []StationSpec{
+			{Name: "s1", Coords: Coords{Lat: 0.00008, Lon: 0.00008}, Docks: 2},
+			{Name: "s2", Coords: Coords{Lat: 0.0004, Lon: 0.0004}, Bikes: 2},
+			{Name: "s3", Coords: Coords{Lat: 0.0001, Lon: 0.0001}},
+		},
+		Renters:      []RenterSpec{{Name: "r", Stations: []string{"s1", "s2"}}},
+		Transports:   []TransportSpec{{Name: "t", Stations: []string{"s1", "s2", "s3"}}},
+		Universities: []UniversitySpec{{Name: "u", Station: "s1"}},
+	}
+	w, err := s.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivered, due := requestBikes(t, w, 2)
+	// a dock of the destination is taken once the haul is accepted, the
+	// clock stands still so the transport can't leave meanwhile
+	runUntil(t, w, w.Clock.Now(), hauling(w.Transports["t"]))
+	w.Stations["s1"].SetDocks(1)
+	if n := awaitDelivery(t, w, due, delivered); n != 1 {
+		t.Errorf("Expected 1 bike delivered, got %d", n)
+	}
+	// the other bike is taken to the nearest station with free docks
+	transports := w.Transports["t"].Instances(bikeTransportProtocol, demo.InstanceCompleted)
+	if len(transports) != 1 || !strings.Contains(transports[0].GetValue("reason"), "1 taken to "+w.Stations["s3"].ID()) {
+		t.Errorf("Expected a bike taken to s3, got %v", transports)
+	}
+	if rides := w.Transports["t"].Instances(bikeRideProtocol, demo.InstanceCompleted); len(rides) != 2 {
+		t.Errorf("Expected 2 rides closed, got %d", len(rides))
+	}
+	// bikes dock asynchronously
+	s3 := w.Stations["s3"].reasoner.bikes
+	runUntil(t, w, due, func() bool { return s3.availableCount() == 1 })
+}
@@ -1,25 +1,92 @@
 package v2
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
-// Coords represents the coordinates of an agent
+// Coords are the geographic coordinates of an agent in decimal degrees,
+// on the WGS 84 datum
 type Coords struct {
-	X, Y float64
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
 }
 
+// Validate that the latitude and the longitude are in range
+func (c Coords) Validate() error {
+	if !(c.Lat >= -90 && c.Lat <= 90) || !(c.Lon >= -180 && c.Lon <= 180) {
+		return fmt.Errorf("Coordinates out of range: %g,%g", c.Lat, c.Lon)
+	}
+	return nil
+}
+
+// String encodes the coordinates as a geo URI (RFC 5870), the format
+// of every protocol parameter carrying a location, e.g.
+// "geo:43.2627,-2.9253"
 func (c Coords) String() string {
-	return fmt.Sprintf("%f,%f", c.X, c.Y)
+	return geoScheme + strconv.FormatFloat(c.Lat, 'f', -1, 64) + "," +
+		strconv.FormatFloat(c.Lon, 'f', -1, 64)
+}
+
+// geoScheme of the URIs of coordinates
+const geoScheme = "geo:"
+
+// parseCoords parses a geo URI. The altitude and the uncertainty are
+// ignored, and the coordinate reference system must be WGS 84.
+func parseCoords(s string) (Coords, error) {
+	c := Coords{}
+	formatErr := fmt.Errorf("Incorrectly formatted coordinates: '%s'", s)
+	if len(s) < len(geoScheme) || !strings.EqualFold(s[:len(geoScheme)], geoScheme) {
+		return c, formatErr
+	}
+	params := strings.Split(s[len(geoScheme):], ";")
+	for _, p := range params[1:] {
+		if kv := strings.SplitN(p, "=", 2); strings.EqualFold(kv[0], "crs") &&
+			(len(kv) != 2 || !strings.EqualFold(kv[1], "wgs84")) {
+			return c, fmt.Errorf("Unsupported coordinate reference system: '%s'", s)
+		}
+	}
+	cStr := strings.Split(params[0], ",")
+	if len(cStr) != 2 && len(cStr) != 3 {
+		return c, formatErr
+	}
+	var err error
+	if c.Lat, err = strconv.ParseFloat(cStr[0], 64); err != nil {
+		return c, formatErr
+	}
+	if c.Lon, err = strconv.ParseFloat(cStr[1], 64); err != nil {
+		return c, formatErr
+	}
+	if len(cStr) == 3 {
+		if _, err = strconv.ParseFloat(cStr[2], 64); err != nil {
+			return c, formatErr
+		}
+	}
+	return c, c.Validate()
 }
 
-type bikeQueue []*Bike
+// unlimitedDocks is the number of free docks reported by the stations
+// without a dock limit
+const unlimitedDocks = -1
 
-func (q *bikeQueue) push(b *Bike) {
-	*q = append(*q, b)
+// stationInfo is a station as known by other agents
+type stationInfo struct {
+	id     string
+	coords Coords
 }
 
-func (q *bikeQueue) pop() *Bike {
+type bikeQueue []string
+
+func (q *bikeQueue) push(bikeID string) {
+	*q = append(*q, bikeID)
+}
+
+func (q *bikeQueue) pop() string {
 	if len(*q) == 0 {
-		return nil
+		return ""
 	}
 	queue := *q
 	b := queue[0]
@@ -31,42 +98,126 @@ func (q *bikeQueue) len() int {
 	return len(*q)
 }
 
+// bikeStorage keeps the bikes docked at a station along with the key
+// of the BikeStorage instance each bike docked with and the expiry of
+// the reserved bikes. Docking fails once every dock slot is taken,
+// reserved bikes take their slot until undocked.
+// It is safe for concurrent use.
 type bikeStorage struct {
+	mutex     sync.Mutex
 	available *bikeQueue
-	reserved  map[string]*Bike
+	reserved  map[string]time.Time
+	docks     map[string]string
+	// capacity is the number of dock slots, unlimited if 0
+	capacity int
 }
 
-func newBikeStorage() bikeStorage {
+func newBikeStorage() *bikeStorage {
 	avalable := make(bikeQueue, 0)
-	reserved := make(map[string]*Bike)
-	return bikeStorage{available: &avalable, reserved: reserved}
+	reserved := make(map[string]time.Time)
+	docks := make(map[string]string)
+	return &bikeStorage{available: &avalable, reserved: reserved, docks: docks}
 }
 
-func (bs bikeStorage) dock(b *Bike) {
-	bs.available.push(b)
+// dock a bike, fails if the bike was already docked or the storage
+// is full
+func (bs *bikeStorage) dock(bikeID, instanceKey string) error {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if _, found := bs.docks[bikeID]; found {
+		return fmt.Errorf("Bike '%s' already docked", bikeID)
+	}
+	if bs.capacity > 0 && len(bs.docks) >= bs.capacity {
+		return fmt.Errorf("No free docks for bike '%s'", bikeID)
+	}
+	bs.available.push(bikeID)
+	bs.docks[bikeID] = instanceKey
+	return nil
+}
+
+// setCapacity sets the number of dock slots, unlimited if 0. The bikes
+// already docked stay even if over capacity.
+func (bs *bikeStorage) setCapacity(capacity int) {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	bs.capacity = capacity
 }
 
-func (bs bikeStorage) reserveBike() *Bike {
-	r := bs.available.pop()
-	if r == nil {
-		return nil
+// freeDocks is the number of dock slots not taken,
+// unlimitedDocks if the storage has no limit
+func (bs *bikeStorage) freeDocks() int {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if bs.capacity == 0 {
+		return unlimitedDocks
 	}
-	bs.reserved[r.ID()] = r
-	return r
+	if free := bs.capacity - len(bs.docks); free > 0 {
+		return free
+	}
+	return 0
 }
 
-func (bs bikeStorage) releaseBike(bikeID string) {
+// reserveBike until it expires, returns an empty
+// string if there are no bikes available
+func (bs *bikeStorage) reserveBike(expiry time.Time) string {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	bikeID := bs.available.pop()
+	if bikeID == "" {
+		return ""
+	}
+	bs.reserved[bikeID] = expiry
+	return bikeID
+}
+
+// cancel the reservation of a bike so that it's available again
+func (bs *bikeStorage) cancel(bikeID string) bool {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if _, reserved := bs.reserved[bikeID]; !reserved {
+		return false
+	}
 	delete(bs.reserved, bikeID)
+	bs.available.push(bikeID)
+	return true
 }
 
-func (bs bikeStorage) has(bikeID string) bool {
-	if _, found := bs.reserved[bikeID]; found {
-		return true
+// expire the reservation of a bike with the given expiry, if the bike
+// is still reserved and wasn't reserved again
+func (bs *bikeStorage) expire(bikeID string, expiry time.Time) bool {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if e, reserved := bs.reserved[bikeID]; !reserved || !e.Equal(expiry) {
+		return false
 	}
-	for _, b := range *bs.available {
-		if b.ID() == bikeID {
-			return true
-		}
+	delete(bs.reserved, bikeID)
+	bs.available.push(bikeID)
+	return true
+}
+
+// undock removes a reserved bike from the storage and returns the key
+// of the instance the bike docked with
+func (bs *bikeStorage) undock(bikeID string) (string, bool) {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if _, reserved := bs.reserved[bikeID]; !reserved {
+		return "", false
 	}
-	return false
+	key := bs.docks[bikeID]
+	delete(bs.reserved, bikeID)
+	delete(bs.docks, bikeID)
+	return key, true
+}
+
+func (bs *bikeStorage) availableCount() int {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	return bs.available.len()
+}
+
+func (bs *bikeStorage) has(bikeID string) bool {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	_, found := bs.docks[bikeID]
+	return found
 }
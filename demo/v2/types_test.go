@@ -0,0 +1,80 @@
+package v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBikeStorage_expire(t *testing.T) {
+	bs := newBikeStorage()
+	bs.dock("bike", "key")
+	start := time.Now()
+	first := start.Add(time.Minute)
+	if bikeID := bs.reserveBike(first); bikeID != "bike" {
+		t.Fatalf("Expected 'bike', got '%s'", bikeID)
+	}
+	if !bs.cancel("bike") || bs.availableCount() != 1 {
+		t.Fatal("Cancelled reservation didn't return the bike")
+	}
+	// the expiry of a cancelled reservation can't free a newer one
+	second := start.Add(2 * time.Minute)
+	bs.reserveBike(second)
+	if bs.expire("bike", first) || bs.availableCount() != 0 {
+		t.Fatal("Stale expiry freed a newer reservation")
+	}
+	if !bs.expire("bike", second) || bs.availableCount() != 1 {
+		t.Fatal("Expired reservation didn't return the bike")
+	}
+	if bs.cancel("bike") {
+		t.Error("Cancelled a reservation that had expired")
+	}
+}
+
+func TestBikeStorage_dock(t *testing.T) {
+	bs := newBikeStorage()
+	if free := bs.freeDocks(); free != unlimitedDocks {
+		t.Fatalf("Expected unlimited docks, got %d", free)
+	}
+	bs.setCapacity(2)
+	if err := bs.dock("first", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.dock("first", "1"); err == nil {
+		t.Error("Bike docked twice")
+	}
+	if err := bs.dock("second", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.dock("third", "3"); err == nil || bs.freeDocks() != 0 {
+		t.Error("Bike docked at a full storage")
+	}
+	// reserved bikes keep their slot until undocked
+	bikeID := bs.reserveBike(time.Now().Add(time.Minute))
+	if bs.freeDocks() != 0 {
+		t.Error("Reserved bike freed its dock")
+	}
+	bs.undock(bikeID)
+	if err := bs.dock("third", "3"); err != nil {
+		t.Errorf("Bike not docked at the freed slot: %s", err)
+	}
+}
+
+func TestParseCoords(t *testing.T) {
+	c := Coords{Lat: 43.2627, Lon: -2.9253}
+	if s := c.String(); s != "geo:43.2627,-2.9253" {
+		t.Errorf("Unexpected geo URI: '%s'", s)
+	}
+	valid := []string{c.String(), "GEO:43.2627,-2.9253", "geo:43.2627,-2.9253,12;u=35", "geo:43.2627,-2.9253;crs=wgs84"}
+	for _, s := range valid {
+		if parsed, err := parseCoords(s); err != nil || parsed != c {
+			t.Errorf("'%s': expected %v, got %v (%v)", s, c, parsed, err)
+		}
+	}
+	invalid := []string{"", "43.2627,-2.9253", "geo:43.2627", "geo:43.2627,west", "geo:91,0", "geo:0,181",
+		"geo:0,0,high", "geo:0,0;crs=mars", "geo:NaN,0"}
+	for _, s := range invalid {
+		if _, err := parseCoords(s); err == nil {
+			t.Errorf("Invalid coordinates '%s' parsed", s)
+		}
+	}
+}
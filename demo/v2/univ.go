@@ -12,22 +12,24 @@ import (
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 	"github.com/mikelsr/nahs/net"
+
+	demo "github.com/mikelsr/nahs-demo/demo"
 )
 
 // University is an agent representing human university
 type University struct {
-	Node          *nahs.Node
-	reasoner      *universityReasoner
-	nearestStaion *Station
+	Node     *nahs.Node
+	reasoner *universityReasoner
 }
 
-// NewUniversity is the default constructor for University
-func NewUniversity(nearest *Station) University {
+// NewUniversity is the default constructor for University, given the
+// ID of its nearest station
+func NewUniversity(o AgentOptions, nearest string) University {
 	u := University{}
 	// the cycle of life
-	u.reasoner = newUniversityReasoner(nearest)
+	u.reasoner = newUniversityReasoner(o, nearest)
 	//u.Node = nahs.NewNode(u.reasoner)
-	u.Node = net.LocalNode(u.reasoner)
+	u.Node = net.LocalNode(u.reasoner, NodeOptions...)
 	u.reasoner.Node = u.Node
 
 	logger.Debugf("\tCreated university with ID %s (%s)", shortID(u.ID()), u.ID())
@@ -39,169 +41,131 @@ func (u University) ID() string {
 	return u.Node.ID().Pretty()
 }
 
-// RequestBikes requests bikes for nearest station
-func (u University) RequestBikes(n int, dt time.Time) error {
+// Instances of a protocol enacted by the university in any of the given
+// states, or the open ones if no state is given
+func (u University) Instances(p bspl.Protocol, states ...demo.InstanceState) []bspl.Instance {
+	return u.reasoner.InstancesIn(p, states...)
+}
 
-	resultc := make(chan int)
+// RequestBikes requests bikes for nearest station and waits until they
+// arrive, returns the number of bikes delivered
+func (u University) RequestBikes(n int, dt time.Time) (int, error) {
+	request := &pendingRequest{offer: make(chan int, 1), delivery: make(chan int, 1)}
 	errc := make(chan error)
 
-	go u.reasoner.requestBikes(n, dt, resultc, errc)
+	go u.reasoner.requestBikes(n, dt, request, errc)
 
+	var offered int
 	select {
-	case result := <-resultc:
-		if result > 0 {
-			logger.Infof("\t[%s] Success requesting '%d' bikes", shortID(u.ID()), result)
-		} else {
-			logger.Infof("\t[%s] bike request denied", shortID(u.ID()))
-		}
+	case offered = <-request.offer:
 	case err := <-errc:
 		logger.Errorf("\t[%s] error requesting bikes: %s", shortID(u.ID()), err)
-		return err
+		return 0, err
+	}
+	if offered == 0 {
+		logger.Infof("\t[%s] bike request denied", shortID(u.ID()))
+		return 0, nil
+	}
+	logger.Infof("\t[%s] Success requesting '%d' bikes", shortID(u.ID()), offered)
+
+	clock := u.reasoner.clock
+	select {
+	case delivered := <-request.delivery:
+		logger.Infof("\t[%s] '%d' of '%d' bikes delivered", shortID(u.ID()), delivered, offered)
+		return delivered, nil
+	case <-clock.After(dt.Sub(clock.Now()) + deliveryGrace):
+		u.reasoner.forgetRequest(request.key)
+		return 0, fmt.Errorf("The delivery of the bikes requested in '%s' wasn't reported", request.key)
 	}
-	return nil
 }
 
-type universityReasoner struct {
-	Node *nahs.Node
+// pendingRequest is a bike request waiting for the answer of the
+// renter and then for the bikes to be delivered
+type pendingRequest struct {
+	key      string
+	offer    chan int
+	delivery chan int
+}
 
-	offeredServices  map[string]bspl.Protocol
-	consumedServices map[string]bspl.Protocol
-	openInstances    map[string]bspl.Instance
-	droppedInstances map[string]bspl.Instance
+type universityReasoner struct {
+	baseReasoner
 
-	bikeRequests map[string]chan int
+	bikeRequests map[string]*pendingRequest
 
-	nearest *Station
+	nearest string
 }
 
-func newUniversityReasoner(nearest *Station) *universityReasoner {
-	u := &universityReasoner{}
-	// initialize maps
-	u.offeredServices = make(map[string]bspl.Protocol)
-	u.openInstances = make(map[string]bspl.Instance)
-	u.droppedInstances = make(map[string]bspl.Instance)
-	// rent bike, ride bike, search for a near station
-	u.consumedServices = map[string]bspl.Protocol{
-		bikeRequestProtocol.Key(): bikeRequestProtocol,
-	}
+func newUniversityReasoner(o AgentOptions, nearest string) *universityReasoner {
+	u := &universityReasoner{baseReasoner: newBaseReasoner(o)}
+	// request bikes
+	u.consume(bikeRequestProtocol, u.instantiateBikeRequest, u.updateBikeRequest)
 
-	u.bikeRequests = make(map[string]chan int)
+	u.bikeRequests = make(map[string]*pendingRequest)
 	u.nearest = nearest
 
 	return u
 }
 
-// DropInstance cancels an Instance for whatever motive
-func (ur *universityReasoner) DropInstance(instanceKey string, motive string) error {
-	instance, found := ur.openInstances[instanceKey]
-	if !found {
-		return fmt.Errorf("Instance '%s' not found", instanceKey)
-	}
-	ur.droppedInstances[instanceKey] = instance
-	delete(ur.openInstances, instanceKey)
-	return nil
-}
-
-// GetInstance returns an Instance given the instance key
-func (ur *universityReasoner) GetInstance(instanceKey string) (bspl.Instance, bool) {
-	instance, found := ur.openInstances[instanceKey]
-	return instance, found
-}
-
-// All instances of a Protocol
-func (ur *universityReasoner) Instances(p bspl.Protocol) []bspl.Instance {
-	instances := make([]bspl.Instance, len(ur.openInstances))
-	i := 0
-	for _, v := range ur.openInstances {
-		instances[i] = v
-		i++
-	}
-	return instances
-}
-
-// Instantiate a protocol. Check if the assigned role is a role
-// the reasoner is willing to play.
-func (ur *universityReasoner) Instantiate(p bspl.Protocol, roles bspl.Roles, ins bspl.Values) (bspl.Instance, error) {
-	if _, consumed := ur.consumedServices[p.Key()]; !consumed {
-		return nil, fmt.Errorf("Protocol '%s' not supported by this Node", p.Key())
-	}
-	switch p.Key() {
-	case bikeRequestProtocol.Key():
-		return ur.instantiateBikeRequest(roles, ins)
-	}
-	return nil, fmt.Errorf("Unkown protocol '%s'", p.Key())
-}
-
 func (ur *universityReasoner) instantiateBikeRequest(roles bspl.Roles, values bspl.Values) (bspl.Instance, error) {
-	id := uuid.New().String()
-	params := make(map[string]string)
-	required := []string{"in bikeNum", "in datetime", "in station"}
-	for _, r := range required {
-		v, found := values[r]
-		if !found {
-			return nil, fmt.Errorf("Missing parameter: '%s'", r)
-		}
-		params[r] = v
+	params, err := requireValues(values, "in bikeNum", "in datetime", "in station")
+	if err != nil {
+		return nil, err
 	}
 	i := imp.NewInstance(bikeRequestProtocol, roles)
-	i.SetValue("ID", id)
+	i.SetValue("ID", uuid.New().String())
 	i.SetValue("bikeNum", params["in bikeNum"])
 	i.SetValue("datetime", params["in datetime"])
 	i.SetValue("station", params["in station"])
-	ur.openInstances[i.Key()] = i
 	return i, nil
 }
 
-// RegisterInstance registers an Instance created by another Reasoner
-func (ur *universityReasoner) RegisterInstance(i bspl.Instance) error {
-	return nil
-}
-
-// UpdateInstance updates an instance with a newer version of itself
-// as long as a valid run from one to the other.
-func (ur *universityReasoner) UpdateInstance(newVersion bspl.Instance) error {
-	i, found := ur.openInstances[newVersion.Key()]
-	if !found {
-		return fmt.Errorf("Instance not found: '%s'", newVersion.Key())
-	}
-	actions, _, err := i.Diff(newVersion)
-	if err != nil {
-		return err
-	}
-	switch i.Protocol().Key() {
-	case bikeRequestProtocol.Key():
-		err = ur.updateBikeRequest(newVersion, actions)
-	}
-	if err != nil {
-		return err
-	}
-	i.Update(newVersion)
-	return nil
-}
-
 func (ur *universityReasoner) updateBikeRequest(j bspl.Instance, actions []bspl.Action) error {
-	if len(actions) != 2 {
+	if len(actions) == 0 {
 		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
 	}
-
-	result := ur.bikeRequests[j.Key()]
-
-	rID := j.GetValue("rID")
-	if rID == "reject" {
-		result <- 0
-	} else if rID != "accept" {
-		return fmt.Errorf("Invalid rID: '%s'", rID)
-	}
-	offerNumStr := j.GetValue("offerNum")
-	offerNum, err := strconv.ParseInt(offerNumStr, 10, 64)
-	if err != nil {
-		return fmt.Errorf("Invalid offerNum: '%s'", offerNumStr)
+	ur.mutex.Lock()
+	request, found := ur.bikeRequests[j.Key()]
+	ur.mutex.Unlock()
+	if !found {
+		return fmt.Errorf("No pending request for instance '%s'", j.Key())
+	}
+
+	switch actions[0].Name {
+	case "accept", "reject":
+		rID := j.GetValue("rID")
+		if rID == "reject" {
+			ur.forgetRequest(j.Key())
+			ur.complete(j.Key())
+			request.offer <- 0
+			return nil
+		} else if rID != "accept" {
+			return fmt.Errorf("Invalid rID: '%s'", rID)
+		}
+		offerNum, err := typed(j).Int("offerNum")
+		if err != nil {
+			return ur.reject(j, err)
+		}
+		// accepted requests stay open until the bikes are delivered
+		request.offer <- offerNum
+	case "delivered", "undelivered":
+		deliveredNum, err := typed(j).Int("deliveredNum")
+		if err != nil {
+			return ur.reject(j, err)
+		}
+		if reason := j.GetValue("reason"); reason != "" {
+			logger.Errorf("\t[%s] Some bikes requested in '%s' weren't delivered: %s",
+				shortID(ur.Node.ID()), j.Key(), reason)
+		}
+		ur.forgetRequest(j.Key())
+		ur.complete(j.Key())
+		request.delivery <- deliveredNum
+	default:
+		return fmt.Errorf("Invalid update for instance '%s'", j.Key())
 	}
-	result <- int(offerNum)
 	return nil
 }
 
-func (ur *universityReasoner) requestBikes(n int, dt time.Time, result chan int, errc chan error) string {
+func (ur *universityReasoner) requestBikes(n int, dt time.Time, request *pendingRequest, errc chan error) string {
 	protocol := bikeRequestProtocol
 	key := protocol.Key()
 	renters := ur.Node.FindContact(key, "Renter")
@@ -211,36 +175,47 @@ func (ur *universityReasoner) requestBikes(n int, dt time.Time, result chan int,
 	}
 	id := renters[0]
 	logger.Infof("\t[%s] Requesting %d bike(s) from %s to station %s at %v",
-		shortID(ur.Node.ID()), n, shortID(id), shortID(ur.nearest.ID()), dt)
+		shortID(ur.Node.ID()), n, shortID(id), shortID(ur.nearest), dt)
 	roles := bspl.Roles{"Requester": ur.Node.ID().Pretty(), "Renter": id.Pretty()}
-	t, err := dt.MarshalText()
-	if err != nil {
-		errc <- err
-		return ""
-	}
 	inputs := bspl.Values{
 		"in bikeNum":  strconv.Itoa(n),
-		"in datetime": string(t),
-		"in station":  ur.nearest.ID(),
+		"in datetime": formatTime(dt),
+		"in station":  ur.nearest,
 	}
 	instance, err := ur.Instantiate(protocol, roles, inputs)
 	if err != nil {
 		errc <- err
 		return ""
 	}
-	ur.Node.OpenInstances[instance.Key()] = id
+	// the instance is updated concurrently once it is sent
+	instanceID := instance.GetValue("ID")
+	ur.Node.SetInstancePeer(instance.Key(), id)
+	// the answer may arrive before the event is acknowledged
+	request.key = instance.Key()
+	ur.mutex.Lock()
+	ur.bikeRequests[instance.Key()] = request
+	ur.mutex.Unlock()
 	event := events.MakeNewEvent(instance)
 	// send event without blocking execution
 	okChan, errChan := sendEventWithResults(ur.Node, id, event)
 	select {
 	case err := <-errChan:
+		ur.forgetRequest(instance.Key())
 		errc <- err
 		return ""
 	case ok := <-okChan:
 		if !ok {
-			errc <- fmt.Errorf("Instance already existed in renter node")
+			ur.forgetRequest(instance.Key())
+			errc <- rejectedBy("Renter", id, instance.Key())
+			return ""
 		}
 	}
-	ur.bikeRequests[instance.Key()] = result
-	return instance.GetValue("ID")
+	return instanceID
+}
+
+// forgetRequest removes a request that won't be answered
+func (ur *universityReasoner) forgetRequest(key string) {
+	ur.mutex.Lock()
+	defer ur.mutex.Unlock()
+	delete(ur.bikeRequests, key)
 }
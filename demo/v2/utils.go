@@ -1,23 +1,61 @@
 package v2
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/mikelsr/bspl"
+	imp "github.com/mikelsr/bspl/implementation"
 	"github.com/mikelsr/nahs"
 	"github.com/mikelsr/nahs/events"
 )
 
 func sendEvent(e events.Event, i bspl.Instance, n *nahs.Node) {
-	target := n.OpenInstances[i.Key()]
+	target := counterpart(i, n)
 	logger.Infof("\t[%s] Send event '%s:%s' to node %s (instance key: %s)",
 		shortID(n.ID()), e.Type(), shortID(e.ID()), shortID(target), i.Key())
 	n.SendEvent(target, e)
 }
 
+// counterpart returns the peer an instance is enacted with, the one
+// assigned to it by the node or else the other role, as every protocol
+// of the demo has two roles
+func counterpart(i bspl.Instance, n *nahs.Node) peer.ID {
+	if id, found := n.InstancePeer(i.Key()); found {
+		return id
+	}
+	self := n.ID().Pretty()
+	for _, actor := range i.Roles() {
+		if actor == self {
+			continue
+		}
+		if id, err := peer.IDB58Decode(actor); err == nil {
+			return id
+		}
+	}
+	return ""
+}
+
+// rejectedBy is the error of a new instance the counterpart didn't take,
+// as its handler failed, e.g. on a value out of range, an unknown
+// station or a key it already had
+func rejectedBy(role string, id peer.ID, key string) error {
+	return fmt.Errorf("%s %s rejected instance '%s'", role, shortID(id), key)
+}
+
+// copyInstance returns a copy of an instance that can be changed
+// while the original is being updated
+func copyInstance(i bspl.Instance) bspl.Instance {
+	c := imp.NewInstance(i.Protocol(), i.Roles())
+	for param, value := range i.Parameters() {
+		c.Parameters()[param] = value
+	}
+	return c
+}
+
 func sendEventWithResults(node *nahs.Node, id peer.ID, event events.Event) (<-chan bool, <-chan error) {
 	okChan := make(chan bool)
 	errChan := make(chan error)
@@ -1,13 +1,13 @@
 module github.com/mikelsr/nahs-demo
 
-go 1.14
+go 1.16
 
 require (
 	github.com/fatih/color v1.9.0
 	github.com/google/uuid v1.1.1
 	github.com/ipfs/go-log v1.0.4
 	github.com/ipfs/go-log/v2 v2.0.8 // indirect
-	github.com/libp2p/go-libp2p v0.9.2 // indirect
+	github.com/libp2p/go-libp2p v0.9.2
 	github.com/libp2p/go-libp2p-circuit v0.2.3 // indirect
 	github.com/libp2p/go-libp2p-core v0.5.6
 	github.com/libp2p/go-libp2p-kad-dht v0.8.0 // indirect
@@ -18,7 +18,15 @@ require (
 	github.com/libp2p/go-maddr-filter v0.1.0 // indirect
 	github.com/mikelsr/bspl v0.0.0-20200618162931-50b84e017c3c
 	github.com/mikelsr/nahs v0.0.0-20200618163030-c517c0ffcb4e
+	github.com/multiformats/go-multiaddr v0.2.2
 	github.com/multiformats/go-multibase v0.0.3 // indirect
 	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2 // indirect
 	golang.org/x/sys v0.0.0-20200523222454-059865788121 // indirect
 )
+
+// patched copies, see third_party/README.md: bspl embeds the rules of
+// its lexer and nahs guards the instance peers of its nodes
+replace (
+	github.com/mikelsr/bspl => ./third_party/bspl
+	github.com/mikelsr/nahs => ./third_party/nahs
+)
@@ -0,0 +1,10 @@
+// Package protocols embeds the BSPL protocols of the demo and their
+// schemas, so that agents don't need the source tree to load them.
+package protocols
+
+import "embed"
+
+// FS holds the protocol files and their schema files
+//
+//go:embed *.bspl *.schema.json
+var FS embed.FS
@@ -0,0 +1,5 @@
+module github.com/mikelsr/bspl
+
+go 1.16
+
+require bitbucket.org/mikelsr/gauzaez v1.0.0
@@ -0,0 +1,5 @@
+package implementation
+
+const (
+	instanceSeparator = ':'
+)
@@ -0,0 +1,12 @@
+package implementation
+
+import (
+	"github.com/mikelsr/bspl/reason"
+)
+
+// Roles assings a libp2p peerID to each role so they are identifiable
+// in the network
+type Roles = reason.Roles
+
+// Values maps Parameter.String() to Value
+type Values = reason.Values
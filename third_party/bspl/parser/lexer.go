@@ -0,0 +1,38 @@
+package parser
+
+import (
+	_ "embed" // lexer rules
+	"encoding/json"
+	"io"
+
+	"bitbucket.org/mikelsr/gauzaez/lexer"
+	"bitbucket.org/mikelsr/gauzaez/lexer/automaton"
+)
+
+// lexerRules are embedded so that the parser doesn't need the source
+// code of the project at runtime
+//
+//go:embed lexer.json
+var lexerRules []byte
+
+// newLexer creates a lexer.Lexer with the lexer.Rules of lexer.json
+func newLexer() (*lexer.Lexer, error) {
+	rules := new(lexer.Rules)
+	if err := json.Unmarshal(lexerRules, rules); err != nil {
+		return nil, err
+	}
+	rules.Tokens = make(map[automaton.Token]bool)
+	for _, t := range rules.TokenStrings {
+		rules.Tokens[t] = true
+	}
+	return lexer.MakeLexer(*rules)
+}
+
+// LexStream passes the input stream throgh an anonimous lexer
+func LexStream(in io.Reader) (*lexer.TokenTable, error) {
+	lex, err := newLexer()
+	if err != nil {
+		return nil, err
+	}
+	return lex.Tokenize(in)
+}
@@ -0,0 +1,6 @@
+package proto
+
+const (
+	// KeySeparator is used to generate Protocol and Instace IDs
+	KeySeparator = ','
+)
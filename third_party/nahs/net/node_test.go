@@ -0,0 +1,60 @@
+package net
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	log "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/mikelsr/bspl"
+)
+
+func TestMain(m *testing.M) {
+	log.SetAllLoggers(log.LevelWarn)
+	log.SetLogLevel(LogName, "debug")
+
+	testKeys = make([]*crypto.PrivKey, testNodeN)
+	_loadTestKeys()
+	_loadTestProtocols()
+	m.Run()
+}
+
+func TestNode_FindContact(t *testing.T) {
+	m := mockReasoner{}
+	p := testProtocol()
+	n := testNodes(2)
+	for _, node := range n {
+		node.reasoner = m
+	}
+	n1, n2 := n[0], n[1]
+
+	n1.AddContact(n2.ID(), Service{
+		Roles:    []bspl.Role{"Seller"},
+		Protocol: p,
+	})
+
+	contacts := n1.FindContact(p.Key(), "Seller")
+	if len(contacts) != 1 || contacts[0] != n2.ID() {
+		t.FailNow()
+	}
+}
+
+// run with -race
+func TestNode_InstancePeer(t *testing.T) {
+	node := testNodes(1)[0]
+	n := 50
+	var wg sync.WaitGroup
+	for k := 0; k < n; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			key := fmt.Sprint(k)
+			node.SetInstancePeer(key, node.ID())
+			if id, found := node.InstancePeer(key); !found || id != node.ID() {
+				t.Errorf("Expected peer '%s' for instance '%s', found '%s'", node.ID(), key, id)
+			}
+		}(k)
+	}
+	wg.Wait()
+}